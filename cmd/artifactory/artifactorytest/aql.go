@@ -0,0 +1,232 @@
+package artifactorytest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var aqlLimit = regexp.MustCompile(`\.limit\((\d+)\)`)
+
+// handleAQL evaluates items.find(...) queries built from $and/$or, plain equality and the
+// $eq, $ne, $match, $nmatch, $gt, $gte, $lt and $lte operators, including @property fields.
+// Results are always sorted by path and name and include every field.
+func (s *Server) handleAQL(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query := string(body)
+	start := strings.Index(query, "items.find(")
+	if start < 0 {
+		writeError(w, http.StatusBadRequest, "only items.find queries are supported")
+		return
+	}
+	var criteria map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(query[start+len("items.find("):]))
+	if err := decoder.Decode(&criteria); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid AQL criteria: "+err.Error())
+		return
+	}
+
+	results := make([]map[string]interface{}, 0)
+	for _, key := range s.sortedKeys() {
+		item := s.items[key]
+		if !matchesCriteria(item, criteria) {
+			continue
+		}
+		results = append(results, aqlResult(item))
+	}
+	if m := aqlLimit.FindStringSubmatch(query); m != nil {
+		if limit, err := strconv.Atoi(m[1]); err == nil && limit < len(results) {
+			results = results[:limit]
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"results": results,
+		"range":   map[string]int{"start_pos": 0, "end_pos": len(results), "total": len(results)},
+	})
+}
+
+func aqlResult(item *Item) map[string]interface{} {
+	dir, name := ".", item.Path
+	if i := strings.LastIndex(item.Path, "/"); i >= 0 {
+		dir, name = item.Path[:i], item.Path[i+1:]
+	}
+	return map[string]interface{}{
+		"repo":        item.Repo,
+		"path":        dir,
+		"name":        name,
+		"type":        "file",
+		"size":        item.Size,
+		"created":     item.Created.UTC().Format(time.RFC3339Nano),
+		"modified":    item.Modified.UTC().Format(time.RFC3339Nano),
+		"sha256":      item.Sha256,
+		"actual_sha1": item.Sha1,
+		"actual_md5":  item.Md5,
+	}
+}
+
+func matchesCriteria(item *Item, criteria map[string]interface{}) bool {
+	fields := aqlResult(item)
+	for field, condition := range criteria {
+		switch field {
+		case "$and", "$or":
+			clauses, _ := condition.([]interface{})
+			matched := field == "$and"
+			for _, clause := range clauses {
+				c, _ := clause.(map[string]interface{})
+				if field == "$and" && !matchesCriteria(item, c) {
+					matched = false
+					break
+				}
+				if field == "$or" && matchesCriteria(item, c) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		default:
+			var values []string
+			if strings.HasPrefix(field, "@") {
+				values = item.Properties[strings.TrimPrefix(field, "@")]
+			} else if v, ok := fields[field]; ok {
+				values = []string{toString(v)}
+			}
+			if !matchesCondition(field, values, condition) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchesCondition(field string, values []string, condition interface{}) bool {
+	operators, ok := condition.(map[string]interface{})
+	if !ok {
+		operators = map[string]interface{}{"$eq": condition}
+	}
+	for operator, operand := range operators {
+		expected := toString(operand)
+		matched := false
+		for _, value := range values {
+			if compare(field, operator, value, expected) {
+				matched = true
+				break
+			}
+		}
+		if operator == "$ne" || operator == "$nmatch" {
+			// negative operators hold when no value violates them
+			matched = true
+			for _, value := range values {
+				if !compare(field, operator, value, expected) {
+					matched = false
+				}
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func compare(field, operator, value, expected string) bool {
+	switch operator {
+	case "$eq":
+		return value == expected
+	case "$ne":
+		return value != expected
+	case "$match":
+		return globMatch(expected, value)
+	case "$nmatch":
+		return !globMatch(expected, value)
+	case "$gt", "$gte", "$lt", "$lte":
+		c := order(field, value, expected)
+		switch operator {
+		case "$gt":
+			return c > 0
+		case "$gte":
+			return c >= 0
+		case "$lt":
+			return c < 0
+		default:
+			return c <= 0
+		}
+	}
+	return false
+}
+
+// order compares times and sizes by value and everything else as strings.
+func order(field, value, expected string) int {
+	if field == "created" || field == "modified" {
+		a, errA := time.Parse(time.RFC3339Nano, value)
+		b, errB := time.Parse(time.RFC3339Nano, expected)
+		if errA == nil && errB == nil {
+			switch {
+			case a.Before(b):
+				return -1
+			case a.After(b):
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	if field == "size" {
+		a, errA := strconv.ParseInt(value, 10, 64)
+		b, errB := strconv.ParseInt(expected, 10, 64)
+		if errA == nil && errB == nil {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	return strings.Compare(value, expected)
+}
+
+// globMatch implements AQL's $match, where * matches any run of characters (slashes
+// included) and ? matches a single character.
+func globMatch(pattern, value string) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	matched, err := regexp.MatchString(b.String(), value)
+	return err == nil && matched
+}
+
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
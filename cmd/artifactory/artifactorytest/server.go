@@ -0,0 +1,782 @@
+// Package artifactorytest provides an in-process fake Artifactory for exercising the
+// artifactory client without a real instance. It implements deploy (a full-body PUT whose
+// X-Checksum headers are verified, or deploy by checksum answering 404 for unknown content),
+// download, delete, item properties, the storage api, server-side copy/move, the multipart
+// upload api and the subset of AQL the client generates.
+package artifactorytest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContextPath is where the fake serves artifactory, mirroring https://host/artifactory.
+const ContextPath = "/artifactory"
+
+// partsPath is where the fake accepts multipart upload parts, standing in for the pre-signed
+// object storage urls artifactory hands out.
+const partsPath = "/_parts/"
+
+type Item struct {
+	Repo       string
+	Path       string
+	Sha256     string
+	Sha1       string
+	Md5        string
+	Size       int64
+	Created    time.Time
+	Modified   time.Time
+	Properties map[string][]string
+}
+
+func (i *Item) RepoPath() string {
+	return i.Repo + "/" + i.Path
+}
+
+// Fault makes the server answer matching requests with Status instead of handling them,
+// Count times (or forever when Count is 0).
+type Fault struct {
+	Method     string
+	PathPrefix string
+	Status     int
+	RetryAfter string
+	Count      int
+}
+
+// upload is a multipart upload in progress, keyed by its token.
+type upload struct {
+	repoPath string
+	parts    map[int][]byte
+	status   string
+	err      string
+}
+
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+}
+
+type Server struct {
+	*httptest.Server
+
+	// Token, when set, must be presented as a bearer token, an API key or a basic auth password.
+	Token string
+	// Now is used for created/modified timestamps and can be overridden for deterministic tests.
+	Now func() time.Time
+	// MultipartUploads enables the multipart upload api. Without it the api answers 404, like
+	// an artifactory that predates it.
+	MultipartUploads bool
+
+	mu       sync.Mutex
+	blobs    blobStore
+	items    map[string]*Item
+	faults   []*Fault
+	requests []Request
+	uploads  map[string]*upload
+	created  int
+}
+
+// NewServer starts a fake artifactory that keeps artifact content in memory.
+func NewServer() *Server {
+	return newServer(memoryStore{})
+}
+
+// NewDirServer starts a fake artifactory that keeps artifact content in dir.
+func NewDirServer(dir string) *Server {
+	return newServer(dirStore(dir))
+}
+
+func newServer(blobs blobStore) *Server {
+	s := &Server{
+		Now:     time.Now,
+		blobs:   blobs,
+		items:   make(map[string]*Item),
+		uploads: make(map[string]*upload),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// BaseURL is the artifactory base url to hand to the client.
+func (s *Server) BaseURL() string {
+	return s.URL + ContextPath
+}
+
+// ArtifactURL is the url of repoPath (repo/path/to/file) on this server.
+func (s *Server) ArtifactURL(repoPath string) string {
+	return s.BaseURL() + "/" + strings.TrimPrefix(repoPath, "/")
+}
+
+// Put seeds an artifact directly, bypassing http.
+func (s *Server) Put(repoPath string, content []byte, modified time.Time, properties map[string]string) *Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item := s.store(repoPath, content)
+	item.Created, item.Modified = modified, modified
+	for key, value := range properties {
+		item.Properties[key] = []string{value}
+	}
+	return item
+}
+
+// Item returns a copy of the artifact at repoPath, or nil.
+func (s *Server) Item(repoPath string) *Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[strings.Trim(repoPath, "/")]
+	if !ok {
+		return nil
+	}
+	c := *item
+	c.Properties = copyProperties(item.Properties)
+	return &c
+}
+
+// Content returns the bytes stored for repoPath.
+func (s *Server) Content(repoPath string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[strings.Trim(repoPath, "/")]
+	if !ok {
+		return nil, false
+	}
+	return s.blobs.get(item.Sha256)
+}
+
+// Items lists every artifact sorted by repo path.
+func (s *Server) Items() []*Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := make([]*Item, 0, len(s.items))
+	for _, key := range s.sortedKeys() {
+		c := *s.items[key]
+		items = append(items, &c)
+	}
+	return items
+}
+
+func (s *Server) InjectFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := fault
+	s.faults = append(s.faults, &f)
+}
+
+// Requests returns every request the server received, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rawPath := r.URL.EscapedPath()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: rawPath, Header: r.Header.Clone()})
+	if fault := s.matchFault(r.Method, rawPath); fault != nil {
+		if fault.RetryAfter != "" {
+			w.Header().Set("Retry-After", fault.RetryAfter)
+		}
+		writeError(w, fault.Status, "injected fault")
+		return
+	}
+	if strings.HasPrefix(rawPath, partsPath) {
+		// part urls are pre-signed and carry no credentials
+		s.handlePart(w, r, strings.TrimPrefix(rawPath, partsPath))
+		return
+	}
+	if strings.HasPrefix(rawPath, ContextPath+"/api/v1/uploads/") {
+		s.handleUploads(w, r, strings.TrimPrefix(rawPath, ContextPath+"/api/v1/uploads/"))
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+	if !strings.HasPrefix(rawPath, ContextPath+"/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	rawPath = strings.TrimPrefix(rawPath, ContextPath+"/")
+
+	switch {
+	case rawPath == "api/search/aql" && r.Method == http.MethodPost:
+		s.handleAQL(w, r)
+	case strings.HasPrefix(rawPath, "api/storage/"):
+		s.handleStorage(w, r, unescape(strings.TrimPrefix(rawPath, "api/storage/")))
+	case strings.HasPrefix(rawPath, "api/copy/") && r.Method == http.MethodPost:
+		s.handleTransfer(w, r, unescape(strings.TrimPrefix(rawPath, "api/copy/")), false)
+	case strings.HasPrefix(rawPath, "api/move/") && r.Method == http.MethodPost:
+		s.handleTransfer(w, r, unescape(strings.TrimPrefix(rawPath, "api/move/")), true)
+	default:
+		s.handleArtifact(w, r, rawPath)
+	}
+}
+
+func (s *Server) matchFault(method, path string) *Fault {
+	for i, fault := range s.faults {
+		if (fault.Method != "" && fault.Method != method) || !strings.HasPrefix(path, fault.PathPrefix) {
+			continue
+		}
+		if fault.Count > 0 {
+			fault.Count--
+			if fault.Count == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return fault
+	}
+	return nil
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	if r.Header.Get("Authorization") == "Bearer "+s.Token || r.Header.Get("X-JFrog-Art-Api") == s.Token {
+		return true
+	}
+	_, password, ok := r.BasicAuth()
+	return ok && password == s.Token
+}
+
+func (s *Server) handleArtifact(w http.ResponseWriter, r *http.Request, rawPath string) {
+	segments := strings.Split(rawPath, ";")
+	repoPath := strings.Trim(unescape(segments[0]), "/")
+	switch r.Method {
+	case http.MethodPut:
+		s.deploy(w, r, repoPath, matrixParams(segments[1:]))
+	case http.MethodGet, http.MethodHead:
+		item, ok := s.items[repoPath]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Could not find resource")
+			return
+		}
+		content, _ := s.blobs.get(item.Sha256)
+		w.Header().Set("X-Checksum-Sha256", item.Sha256)
+		w.Header().Set("X-Checksum-Sha1", item.Sha1)
+		w.Header().Set("X-Checksum-Md5", item.Md5)
+		w.Header().Set("Content-Length", strconv.FormatInt(item.Size, 10))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(content)
+		}
+	case http.MethodDelete:
+		deleted := 0
+		for _, key := range s.sortedKeys() {
+			if key == repoPath || strings.HasPrefix(key, repoPath+"/") {
+				delete(s.items, key)
+				deleted++
+			}
+		}
+		if deleted == 0 {
+			writeError(w, http.StatusNotFound, "Could not locate artifact '"+repoPath+"'")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) deploy(w http.ResponseWriter, r *http.Request, repoPath string, properties map[string]string) {
+	if !strings.Contains(repoPath, "/") {
+		writeError(w, http.StatusBadRequest, "deploy path must include a repository and file name")
+		return
+	}
+	expected := expectedChecksums(r.Header)
+
+	if r.Header.Get("X-Checksum-Deploy") == "true" {
+		// like artifactory, deploy by sha256 or else by sha1 from content already stored
+		content, ok := s.blobs.get(expected.sha256)
+		if expected.sha256 == "" {
+			content, ok = s.contentBySha1(expected.sha1)
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, "Checksum deploy failed: no artifact with checksum found")
+			return
+		}
+		s.finishDeploy(w, repoPath, content, properties)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	actual := checksumsOf(body)
+	for _, pair := range [][2]string{{expected.sha256, actual.sha256}, {expected.sha1, actual.sha1}, {expected.md5, actual.md5}} {
+		if pair[0] != "" && !strings.EqualFold(pair[0], pair[1]) {
+			writeError(w, http.StatusConflict, "Checksum policy rejected the artifact: expected "+pair[0]+" but was "+pair[1])
+			return
+		}
+	}
+	s.finishDeploy(w, repoPath, body, properties)
+}
+
+func (s *Server) contentBySha1(sha1Sum string) ([]byte, bool) {
+	if sha1Sum == "" {
+		return nil, false
+	}
+	for _, item := range s.items {
+		if item.Sha1 == sha1Sum {
+			return s.blobs.get(item.Sha256)
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) finishDeploy(w http.ResponseWriter, repoPath string, content []byte, properties map[string]string) {
+	item := s.store(repoPath, content)
+	for key, value := range properties {
+		item.Properties[key] = []string{value}
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"repo":        item.Repo,
+		"path":        "/" + item.Path,
+		"created":     item.Created.Format(time.RFC3339Nano),
+		"downloadUri": s.ArtifactURL(repoPath),
+		"size":        strconv.FormatInt(item.Size, 10),
+		"checksums":   map[string]string{"sha1": item.Sha1, "md5": item.Md5, "sha256": item.Sha256},
+	})
+}
+
+func (s *Server) store(repoPath string, content []byte) *Item {
+	repoPath = strings.Trim(repoPath, "/")
+	sums := checksumsOf(content)
+	s.blobs.put(sums.sha256, content)
+	now := s.Now()
+	repo, path, _ := strings.Cut(repoPath, "/")
+	item, ok := s.items[repoPath]
+	if !ok {
+		item = &Item{Repo: repo, Path: path, Created: now, Properties: map[string][]string{}}
+		s.items[repoPath] = item
+	}
+	item.Sha256, item.Sha1, item.Md5 = sums.sha256, sums.sha1, sums.md5
+	item.Size = int64(len(content))
+	item.Modified = now
+	return item
+}
+
+// Upload returns how many parts of the multipart upload with token were received, or -1. Tokens
+// are handed out as upload-1, upload-2, ...
+func (s *Server) Upload(token string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[token]
+	if !ok {
+		return -1
+	}
+	return len(u.parts)
+}
+
+// ExpireUploads forgets every multipart upload, as artifactory does once their tokens expire.
+func (s *Server) ExpireUploads() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads = make(map[string]*upload)
+}
+
+func (s *Server) handleUploads(w http.ResponseWriter, r *http.Request, action string) {
+	if !s.MultipartUploads {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	if action == "create" {
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "Bad credentials")
+			return
+		}
+		repoKey, repoPath := query.Get("repoKey"), strings.Trim(query.Get("repoPath"), "/")
+		if repoKey == "" || repoPath == "" {
+			writeError(w, http.StatusBadRequest, "repoKey and repoPath are required")
+			return
+		}
+		s.created++
+		token := "upload-" + strconv.Itoa(s.created)
+		s.uploads[token] = &upload{repoPath: repoKey + "/" + repoPath, parts: map[int][]byte{}}
+		writeJSON(w, http.StatusOK, map[string]string{"token": token})
+		return
+	}
+
+	// every other action is authorized by the upload's token
+	u, ok := s.uploads[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Invalid or expired upload token")
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	switch action {
+	case "urlPart":
+		part, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil || part < 1 {
+			writeError(w, http.StatusBadRequest, "invalid partNumber")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"url": s.URL + partsPath + token + "/" + strconv.Itoa(part)})
+	case "complete":
+		var content []byte
+		for part := 1; part <= len(u.parts); part++ {
+			p, ok := u.parts[part]
+			if !ok {
+				u.status, u.err = "ABORTED", "part "+strconv.Itoa(part)+" is missing"
+				break
+			}
+			content = append(content, p...)
+		}
+		if u.status == "" {
+			if sums := checksumsOf(content); !strings.EqualFold(sums.sha1, query.Get("sha1")) {
+				u.status, u.err = "ABORTED", "checksum mismatch: expected "+query.Get("sha1")+" but was "+sums.sha1
+			} else {
+				s.store(u.repoPath, content)
+				u.status = "FINISHED"
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case "status":
+		status := u.status
+		if status == "" {
+			status = "PARTS"
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": status, "error": u.err, "progress": 100})
+	case "abort":
+		delete(s.uploads, token)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) handlePart(w http.ResponseWriter, r *http.Request, rawPath string) {
+	token, number, _ := strings.Cut(rawPath, "/")
+	u, ok := s.uploads[token]
+	part, err := strconv.Atoi(number)
+	if !ok || err != nil || r.Method != http.MethodPut {
+		writeError(w, http.StatusForbidden, "Request has expired")
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	u.parts[part] = body
+	w.Header().Set("ETag", `"`+checksumsOf(body).md5+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleStorage(w http.ResponseWriter, r *http.Request, repoPath string) {
+	repoPath = strings.Trim(repoPath, "/")
+	query := r.URL.Query()
+	targets := s.under(repoPath)
+	recursive := query.Get("recursive") != "0"
+	if !recursive {
+		if item, ok := s.items[repoPath]; ok {
+			targets = []*Item{item}
+		}
+	}
+
+	if _, ok := query["properties"]; ok {
+		if len(targets) == 0 {
+			writeError(w, http.StatusNotFound, "Unable to find item")
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			properties := parseProperties(query.Get("properties"))
+			for _, item := range targets {
+				for key, values := range properties {
+					item.Properties[key] = values
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			for _, item := range targets {
+				for _, key := range strings.Split(query.Get("properties"), ",") {
+					delete(item.Properties, key)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			item, ok := s.items[repoPath]
+			if !ok || len(item.Properties) == 0 {
+				writeError(w, http.StatusNotFound, "No properties could be found.")
+				return
+			}
+			properties := copyProperties(item.Properties)
+			if keys := query.Get("properties"); keys != "" {
+				properties = map[string][]string{}
+				for _, key := range strings.Split(keys, ",") {
+					if values, ok := item.Properties[key]; ok {
+						properties[key] = values
+					}
+				}
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"properties": properties, "uri": s.storageURI(repoPath)})
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if _, ok := query["list"]; ok {
+		files := make([]map[string]interface{}, 0, len(targets))
+		for _, item := range targets {
+			files = append(files, map[string]interface{}{
+				"uri":          strings.TrimPrefix(item.RepoPath(), repoPath),
+				"size":         item.Size,
+				"lastModified": item.Modified.Format(time.RFC3339Nano),
+				"folder":       false,
+				"sha1":         item.Sha1,
+				"sha2":         item.Sha256,
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"uri": s.storageURI(repoPath), "created": s.Now().Format(time.RFC3339Nano), "files": files})
+		return
+	}
+	if item, ok := s.items[repoPath]; ok {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"repo":         item.Repo,
+			"path":         "/" + item.Path,
+			"created":      item.Created.Format(time.RFC3339Nano),
+			"lastModified": item.Modified.Format(time.RFC3339Nano),
+			"size":         strconv.FormatInt(item.Size, 10),
+			"checksums":    map[string]string{"sha1": item.Sha1, "md5": item.Md5, "sha256": item.Sha256},
+			"uri":          s.storageURI(repoPath),
+		})
+		return
+	}
+	if len(targets) == 0 && strings.Contains(repoPath, "/") {
+		writeError(w, http.StatusNotFound, "Unable to find item")
+		return
+	}
+	children := make([]map[string]interface{}, 0)
+	seen := map[string]bool{}
+	for _, item := range targets {
+		rest := strings.TrimPrefix(strings.TrimPrefix(item.RepoPath(), repoPath), "/")
+		name, _, isFolder := strings.Cut(rest, "/")
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		children = append(children, map[string]interface{}{"uri": "/" + name, "folder": isFolder})
+	}
+	repo, path, _ := strings.Cut(repoPath, "/")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"repo": repo, "path": "/" + path, "children": children, "uri": s.storageURI(repoPath)})
+}
+
+func (s *Server) handleTransfer(w http.ResponseWriter, r *http.Request, repoPath string, move bool) {
+	repoPath = strings.Trim(repoPath, "/")
+	to := strings.Trim(r.URL.Query().Get("to"), "/")
+	dryRun := r.URL.Query().Get("dry") == "1"
+	sources := s.under(repoPath)
+	if len(sources) == 0 {
+		writeError(w, http.StatusNotFound, "Could not find source "+repoPath)
+		return
+	}
+	operation := "copying"
+	if move {
+		operation = "moving"
+	}
+	messages := make([]map[string]string, 0, len(sources))
+	for _, item := range sources {
+		target := to + strings.TrimPrefix(item.RepoPath(), repoPath)
+		messages = append(messages, map[string]string{"level": "INFO", "message": operation + " " + item.RepoPath() + " to " + target})
+		if dryRun {
+			continue
+		}
+		content, _ := s.blobs.get(item.Sha256)
+		copied := s.store(target, content)
+		copied.Properties = copyProperties(item.Properties)
+		if move {
+			delete(s.items, item.RepoPath())
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"messages": messages})
+}
+
+// under returns the item at repoPath or every item beneath it when it is a folder.
+func (s *Server) under(repoPath string) []*Item {
+	var items []*Item
+	for _, key := range s.sortedKeys() {
+		if key == repoPath || repoPath == "" || strings.HasPrefix(key, repoPath+"/") {
+			items = append(items, s.items[key])
+		}
+	}
+	return items
+}
+
+func (s *Server) sortedKeys() []string {
+	keys := make([]string, 0, len(s.items))
+	for key := range s.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) storageURI(repoPath string) string {
+	return s.BaseURL() + "/api/storage/" + repoPath
+}
+
+type checksums struct {
+	sha256 string
+	sha1   string
+	md5    string
+}
+
+func checksumsOf(content []byte) checksums {
+	sha256Sum := sha256.Sum256(content)
+	sha1Sum := sha1.Sum(content)
+	md5Sum := md5.Sum(content)
+	return checksums{
+		sha256: hex.EncodeToString(sha256Sum[:]),
+		sha1:   hex.EncodeToString(sha1Sum[:]),
+		md5:    hex.EncodeToString(md5Sum[:]),
+	}
+}
+
+func expectedChecksums(header http.Header) checksums {
+	return checksums{
+		sha256: strings.ToLower(header.Get("X-Checksum-Sha256")),
+		sha1:   strings.ToLower(header.Get("X-Checksum-Sha1")),
+		md5:    strings.ToLower(header.Get("X-Checksum")),
+	}
+}
+
+func matrixParams(params []string) map[string]string {
+	properties := make(map[string]string, len(params))
+	for _, param := range params {
+		key, value, _ := strings.Cut(param, "=")
+		if key != "" {
+			properties[unescape(key)] = unescape(value)
+		}
+	}
+	return properties
+}
+
+// parseProperties reads artifactory's key=value;key=value list, honouring backslash escapes.
+func parseProperties(value string) map[string][]string {
+	properties := map[string][]string{}
+	for _, pair := range splitUnescaped(value, ';') {
+		parts := splitUnescaped(pair, '=')
+		if len(parts) < 2 || parts[0] == "" {
+			continue
+		}
+		properties[unescapeProperty(parts[0])] = []string{unescapeProperty(strings.Join(parts[1:], "="))}
+	}
+	return properties
+}
+
+func splitUnescaped(value string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+func unescapeProperty(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+func unescape(value string) string {
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+	return unescaped
+}
+
+func copyProperties(properties map[string][]string) map[string][]string {
+	c := make(map[string][]string, len(properties))
+	for key, values := range properties {
+		c[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"errors": []map[string]interface{}{{"status": status, "message": message}},
+	})
+}
+
+type blobStore interface {
+	put(sha256Sum string, content []byte)
+	get(sha256Sum string) ([]byte, bool)
+}
+
+type memoryStore map[string][]byte
+
+func (m memoryStore) put(sha256Sum string, content []byte) {
+	m[sha256Sum] = append([]byte(nil), content...)
+}
+
+func (m memoryStore) get(sha256Sum string) ([]byte, bool) {
+	content, ok := m[sha256Sum]
+	return content, ok
+}
+
+type dirStore string
+
+func (d dirStore) put(sha256Sum string, content []byte) {
+	_ = os.MkdirAll(string(d), 0o755)
+	_ = ioutil.WriteFile(filepath.Join(string(d), sha256Sum), content, 0o644)
+}
+
+func (d dirStore) get(sha256Sum string) ([]byte, bool) {
+	if sha256Sum == "" {
+		return nil, false
+	}
+	content, err := ioutil.ReadFile(filepath.Join(string(d), sha256Sum))
+	return content, err == nil
+}
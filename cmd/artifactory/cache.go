@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"usi/pkg/errors"
+)
+
+func CacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "usi", "artifactory"), nil
+}
+
+func hashURL(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+// Cache stores downloaded artifacts by their sha256 and remembers which sha256 each
+// url last resolved to, so a url can be served without asking artifactory.
+type Cache struct {
+	dir string
+}
+
+func OpenCache() (*Cache, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// blobPath is only called with sums that passed validSha256, so a checksum reported by the
+// server can never point outside the cache.
+func (c *Cache) blobPath(sha256Sum string) string {
+	return filepath.Join(c.dir, "sha256", sha256Sum[:2], sha256Sum)
+}
+
+// validSha256 tells whether s is a sha256 as the cache stores it: 64 lowercase hex characters.
+func validSha256(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Cache) indexPath(url string) string {
+	return filepath.Join(c.dir, "urls", hashURL(url))
+}
+
+// Has tells whether the blob is cached. Anything but a valid sha256 is a miss.
+func (c *Cache) Has(sha256Sum string) bool {
+	if !validSha256(sha256Sum) {
+		return false
+	}
+	_, err := os.Stat(c.blobPath(sha256Sum))
+	return err == nil
+}
+
+func (c *Cache) Lookup(url string) (string, bool) {
+	b, err := ioutil.ReadFile(c.indexPath(url))
+	if err != nil {
+		return "", false
+	}
+	sha256Sum := strings.TrimSpace(string(b))
+	return sha256Sum, c.Has(sha256Sum)
+}
+
+func (c *Cache) Record(url, sha256Sum string) error {
+	if !validSha256(sha256Sum) {
+		return invalidSha256(sha256Sum)
+	}
+	path := c.indexPath(url)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(sha256Sum), 0o644)
+}
+
+// TempFile returns a file inside the cache dir so Store can move it into place with a rename.
+func (c *Cache) TempFile() (*os.File, error) {
+	dir := filepath.Join(c.dir, "tmp")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return ioutil.TempFile(dir, "download-")
+}
+
+func (c *Cache) Store(url, sha256Sum, tmpPath string) error {
+	if !validSha256(sha256Sum) {
+		return invalidSha256(sha256Sum)
+	}
+	path := c.blobPath(sha256Sum)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return c.Record(url, sha256Sum)
+}
+
+func (c *Cache) CopyTo(sha256Sum, dest string) error {
+	if !validSha256(sha256Sum) {
+		return invalidSha256(sha256Sum)
+	}
+	src, err := os.Open(c.blobPath(sha256Sum))
+	if err != nil {
+		return err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(src)
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	dst, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func invalidSha256(sha256Sum string) error {
+	return errors.WithCode(fmt.Sprintf("invalid sha256 %q", sha256Sum), errors.BadRequest)
+}
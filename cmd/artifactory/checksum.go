@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	HeaderChecksumDeploy = "X-Checksum-Deploy"
+	HeaderChecksumSha256 = "X-Checksum-Sha256"
+	HeaderChecksumSha1   = "X-Checksum-Sha1"
+	HeaderChecksumMd5    = "X-Checksum"
+
+	// artifactory reports the stored MD5 under a different header than the one it accepts on deploy
+	HeaderResponseChecksumMd5 = "X-Checksum-Md5"
+)
+
+type Checksums struct {
+	Sha256 string `json:"sha256"`
+	Sha1   string `json:"sha1"`
+	Md5    string `json:"md5"`
+}
+
+func ComputeChecksums(r io.Reader) (*Checksums, int64, error) {
+	sha256Hash := sha256.New()
+	sha1Hash := sha1.New()
+	md5Hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(sha256Hash, sha1Hash, md5Hash), r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &Checksums{
+		Sha256: hex.EncodeToString(sha256Hash.Sum(nil)),
+		Sha1:   hex.EncodeToString(sha1Hash.Sum(nil)),
+		Md5:    hex.EncodeToString(md5Hash.Sum(nil)),
+	}, size, nil
+}
+
+func FileChecksums(path string) (*Checksums, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	return ComputeChecksums(f)
+}
+
+func (c *Checksums) SetHeaders(header http.Header) {
+	header.Set(HeaderChecksumSha256, c.Sha256)
+	header.Set(HeaderChecksumSha1, c.Sha1)
+	header.Set(HeaderChecksumMd5, c.Md5)
+}
+
+func ChecksumsFromHeaders(header http.Header) *Checksums {
+	md5Sum := header.Get(HeaderResponseChecksumMd5)
+	if md5Sum == "" {
+		md5Sum = header.Get(HeaderChecksumMd5)
+	}
+	return &Checksums{
+		Sha256: header.Get(HeaderChecksumSha256),
+		Sha1:   header.Get(HeaderChecksumSha1),
+		Md5:    md5Sum,
+	}
+}
+
+func (c *Checksums) IsEmpty() bool {
+	return c.Sha256 == "" && c.Sha1 == "" && c.Md5 == ""
+}
+
+// Verify compares every checksum the expected value carries and ignores the ones it doesn't.
+func (c *Checksums) Verify(expected *Checksums) error {
+	pairs := []struct {
+		name     string
+		actual   string
+		expected string
+	}{
+		{"sha256", c.Sha256, expected.Sha256},
+		{"sha1", c.Sha1, expected.Sha1},
+		{"md5", c.Md5, expected.Md5},
+	}
+	for _, pair := range pairs {
+		if pair.expected == "" {
+			continue
+		}
+		if !strings.EqualFold(pair.actual, pair.expected) {
+			return fmt.Errorf("%s checksum mismatch: expected %s, got %s", pair.name, pair.expected, pair.actual)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+
+	"usi/pkg/errors"
+)
+
+type CleanupPolicy struct {
+	OlderThan *time.Time
+	KeepLast  int
+}
+
+func CmdCleanup(app *cli.Cmd) {
+	app.Spec = "[ --path=<glob> ] [ --name=<pattern> ] [ --older-than=<age> ] [ --keep=<n> ] [ -j=<jobs> ] [ -d | -y ] URL REPO"
+	baseURL := app.StringArg("URL", "", "artifactory base url (e.g. https://host/artifactory)")
+	repo := app.StringArg("REPO", "", "repository to clean up")
+	path := app.StringOpt("path", "", "path glob within the repository (e.g. snapshots/*)")
+	name := app.StringOpt("name", "", "artifact name pattern (e.g. *.tar.gz)")
+	olderThan := app.StringOpt("older-than", "", "delete artifacts last modified before a date, RFC3339 time or age (e.g. 2024-01-31, 36h, 30d)")
+	keep := app.IntOpt("keep", 0, "keep the newest n artifacts in each folder")
+	jobs := app.IntOpt("j jobs", 4, "number of artifacts to delete in parallel")
+	dryRun := app.BoolOpt("d dry-run", false, "only report what would be deleted")
+	yes := app.BoolOpt("y yes", false, "delete without asking for confirmation")
+	app.Action = func() {
+		policy := CleanupPolicy{KeepLast: *keep}
+		if *olderThan != "" {
+			t, err := ParseTime(*olderThan, time.Now())
+			if err != nil {
+				HandleError(err)
+			}
+			policy.OlderThan = &t
+		}
+		if policy.OlderThan == nil && policy.KeepLast <= 0 {
+			HandleError(errors.WithCode("one of --older-than or --keep is required", errors.BadRequest))
+		}
+
+		query := SearchQuery{Repo: *repo, Path: *path, Name: *name}
+		if policy.KeepLast <= 0 {
+			// keeping the newest per folder needs every item, otherwise let artifactory filter by age
+			query.ModifiedBefore = policy.OlderThan
+		}
+		items, err := Search(*baseURL, query)
+		if err != nil {
+			HandleError(err)
+		}
+		selected := policy.Select(items)
+		PrintCleanupReport(selected)
+		if len(selected) == 0 || *dryRun {
+			return
+		}
+		if !*yes && !Confirm(fmt.Sprintf("Delete %d artifact(s) from %s?", len(selected), *repo)) {
+			fmt.Println("Aborted")
+			return
+		}
+		HandleError(DeleteAll(*baseURL, selected, *jobs))
+	}
+}
+
+// Select returns the items the policy deletes. Age and keep-last combine, so with both
+// set an item is deleted only when it is old enough and not one of the newest in its folder.
+func (p CleanupPolicy) Select(items []Item) []Item {
+	folders := make(map[string][]Item)
+	for _, item := range items {
+		folders[item.Repo+"/"+item.Path] = append(folders[item.Repo+"/"+item.Path], item)
+	}
+
+	var selected []Item
+	for _, folder := range sortedKeys(folders) {
+		folderItems := folders[folder]
+		sort.SliceStable(folderItems, func(i, j int) bool {
+			return folderItems[i].Modified.After(folderItems[j].Modified)
+		})
+		if p.KeepLast > 0 {
+			if len(folderItems) <= p.KeepLast {
+				continue
+			}
+			folderItems = folderItems[p.KeepLast:]
+		}
+		for _, item := range folderItems {
+			if p.OlderThan == nil || item.Modified.Before(*p.OlderThan) {
+				selected = append(selected, item)
+			}
+		}
+	}
+	return selected
+}
+
+func PrintCleanupReport(items []Item) {
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "DELETE\tSIZE\tMODIFIED")
+	for _, item := range items {
+		total += item.Size
+		_, _ = fmt.Fprintf(w, "%s/%s\t%s\t%s\n", item.Repo, item.FullPath(), FormatBytes(item.Size),
+			item.Modified.Local().Format(time.RFC3339))
+	}
+	_ = w.Flush()
+	fmt.Printf("%d artifact(s), %s would be freed\n", len(items), FormatBytes(total))
+}
+
+func DeleteAll(baseURL string, items []Item, jobs int) error {
+	progress := NewProgress(len(items))
+	results := RunParallel(items, jobs, func(item Item) (Item, error) {
+		_, _, err := Delete(JoinURL(strings.TrimSuffix(baseURL, "/")+"/"+item.Repo, item.FullPath()))
+		progress.Add(item.Size, err == nil)
+		return item, err
+	})
+	progress.Done()
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("FAILED %s/%s: %s\n", result.Value.Repo, result.Value.FullPath(), result.Err.Error())
+		}
+	}
+	fmt.Printf("Deleted %d artifact(s), %d failed\n", len(items)-failed, failed)
+	if failed > 0 {
+		return errors.WithCode(fmt.Sprintf("%d of %d deletes failed", failed, len(items)), errors.BadRequest)
+	}
+	return nil
+}
+
+func Confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCleanupPolicySelect(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	item := func(path, name string, age time.Duration) Item {
+		return Item{Repo: "libs", Path: path, Name: name, Modified: now.Add(-age)}
+	}
+	items := []Item{
+		item("app/1", "a.tar.gz", 30*24*time.Hour),
+		item("app/1", "b.tar.gz", 10*24*time.Hour),
+		item("app/1", "c.tar.gz", 1*24*time.Hour),
+		item("web/1", "x.tar.gz", 20*24*time.Hour),
+		item("web/1", "y.tar.gz", 2*24*time.Hour),
+	}
+	weekAgo := now.Add(-7 * 24 * time.Hour)
+	monthAgo := now.Add(-31 * 24 * time.Hour)
+
+	tests := []struct {
+		name   string
+		policy CleanupPolicy
+		want   []string
+	}{
+		{name: "older than", policy: CleanupPolicy{OlderThan: &weekAgo},
+			want: []string{"app/1/b.tar.gz", "app/1/a.tar.gz", "web/1/x.tar.gz"}},
+		{name: "keep last", policy: CleanupPolicy{KeepLast: 1},
+			want: []string{"app/1/b.tar.gz", "app/1/a.tar.gz", "web/1/x.tar.gz"}},
+		{name: "keep last two", policy: CleanupPolicy{KeepLast: 2},
+			want: []string{"app/1/a.tar.gz"}},
+		{name: "keep more than a folder has", policy: CleanupPolicy{KeepLast: 5}},
+		{name: "old and not kept", policy: CleanupPolicy{OlderThan: &weekAgo, KeepLast: 2},
+			want: []string{"app/1/a.tar.gz"}},
+		{name: "nothing old enough", policy: CleanupPolicy{OlderThan: &monthAgo}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, selected := range tt.policy.Select(items) {
+				got = append(got, selected.FullPath())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
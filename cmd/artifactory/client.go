@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"usi/pkg/errors"
+)
+
+const (
+	maxAttempts   = 5
+	baseBackoff   = 500 * time.Millisecond
+	maxBackoff    = 30 * time.Second
+	maxRetryAfter = 2 * time.Minute
+)
+
+var retryableStatus = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+func NewRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := CredentialsFor(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/octet-stream")
+	creds.Apply(req)
+	return req, nil
+}
+
+// Send performs the request, retrying transient failures with exponential backoff.
+// Requests with a body are only retried when the body can be replayed through GetBody.
+func Send(req *http.Request) (*http.Response, error) {
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if attempt >= maxAttempts || !replayable {
+			return res, err
+		}
+
+		var wait time.Duration
+		var reason string
+		switch {
+		case err != nil && isTransient(err):
+			wait, reason = backoff(attempt), err.Error()
+		case err != nil:
+			return nil, err
+		case retryableStatus[res.StatusCode]:
+			wait, reason = retryAfter(res, attempt), res.Status
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			_ = res.Body.Close()
+		default:
+			return res, nil
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "%s %s: %s, retrying in %s (attempt %d/%d)\n",
+			req.Method, req.URL, reason, wait.Round(time.Millisecond), attempt+1, maxAttempts)
+		time.Sleep(wait)
+	}
+}
+
+// Do sends the request and reads the whole response body. Non-2xx responses are
+// returned as an error alongside the response so callers can still inspect them.
+func Do(req *http.Request) (*http.Response, []byte, error) {
+	res, err := Send(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, body, CheckResponse(req, res, body)
+}
+
+func CheckResponse(req *http.Request, res *http.Response, body []byte) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	message := fmt.Sprintf("%s %s failed with %s: %s", req.Method, req.URL, res.Status, errorMessage(body))
+	switch res.StatusCode {
+	case http.StatusBadRequest:
+		return errors.WithCode(message, errors.BadRequest)
+	case http.StatusUnauthorized:
+		return errors.WithCode(message, errors.Unauthorized)
+	case http.StatusForbidden:
+		return errors.WithCode(message, errors.Forbidden)
+	case http.StatusNotFound:
+		return errors.WithCode(message, errors.NotFound)
+	case http.StatusConflict:
+		return errors.WithCode(message, errors.Conflict)
+	case http.StatusNotImplemented:
+		return errors.WithCode(message, errors.NotImplemented)
+	default:
+		return errors.WithCode(message, errors.Unexpected)
+	}
+}
+
+// errorMessage pulls the messages out of artifactory's {"errors":[{"status":..,"message":..}]} body.
+func errorMessage(body []byte) string {
+	var result struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &result); err == nil && len(result.Errors) > 0 {
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return strings.Join(messages, "; ")
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func isTransient(err error) bool {
+	var netErr net.Error
+	return goerrors.Is(err, syscall.ECONNRESET) ||
+		goerrors.Is(err, syscall.EPIPE) ||
+		goerrors.Is(err, io.EOF) ||
+		goerrors.Is(err, io.ErrUnexpectedEOF) ||
+		(goerrors.As(err, &netErr) && netErr.Timeout())
+}
+
+func backoff(attempt int) time.Duration {
+	wait := baseBackoff << (attempt - 1)
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+func retryAfter(res *http.Response, attempt int) time.Duration {
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return backoff(attempt)
+	}
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = time.Until(at)
+	} else {
+		return backoff(attempt)
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	return wait
+}
+
+func PrintResponse(res *http.Response, body []byte) {
+	fmt.Println(res)
+	fmt.Println(string(body))
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"usi/pkg/errors"
+)
+
+const apiKeyHeader = "X-JFrog-Art-Api"
+
+// Credentials holds whichever form of authentication a source provided. A token wins
+// over an API key, which wins over basic auth.
+type Credentials struct {
+	Token    string `json:"token,omitempty"`
+	APIKey   string `json:"api_key,omitempty"`
+	User     string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Source   string `json:"-"`
+}
+
+func (c *Credentials) IsEmpty() bool {
+	return c.Token == "" && c.APIKey == "" && (c.User == "" || c.Password == "")
+}
+
+func (c *Credentials) Apply(req *http.Request) {
+	switch {
+	case c.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.APIKey != "":
+		req.Header.Set(apiKeyHeader, c.APIKey)
+	default:
+		req.SetBasicAuth(c.User, c.Password)
+	}
+}
+
+// CredentialSource looks up credentials for an artifactory url. Sources return nil
+// credentials (and no error) when they have nothing for the url.
+type CredentialSource interface {
+	Name() string
+	Lookup(u *url.URL) (*Credentials, error)
+}
+
+var CredentialChain = []CredentialSource{
+	EnvCredentials{},
+	NetrcCredentials{},
+	ConfigCredentials{},
+	HelperCredentials{},
+}
+
+var credentialCache sync.Map
+
+// CredentialsFor walks the credential chain in order and returns the first match,
+// remembering it per server so helpers aren't invoked for every request.
+func CredentialsFor(u *url.URL) (*Credentials, error) {
+	key, err := credentialKey(u)
+	if err != nil {
+		return nil, errors.WithCode(fmt.Sprintf("config credentials: %s", err.Error()), errors.BadRequest)
+	}
+	if cached, ok := credentialCache.Load(key); ok {
+		return cached.(*Credentials), nil
+	}
+	for _, source := range CredentialChain {
+		creds, err := source.Lookup(u)
+		if err != nil {
+			return nil, errors.WithCode(fmt.Sprintf("%s credentials: %s", source.Name(), err.Error()), errors.BadRequest)
+		}
+		if creds != nil && !creds.IsEmpty() {
+			creds.Source = source.Name()
+			credentialCache.Store(key, creds)
+			return creds, nil
+		}
+	}
+	return nil, errors.WithCode(fmt.Sprintf("no artifactory credentials found for %s: set ARTIFACTORY_TOKEN, "+
+		"add a ~/.netrc entry, add it to %s or configure a credential helper", u.Host, configPath()), errors.Unauthorized)
+}
+
+// credentialKey is the server u belongs to: the matching config entry's url, so instances
+// sharing a host under different paths keep their own credentials, or else the base url.
+func credentialKey(u *url.URL) (string, error) {
+	server, err := serverFor(u)
+	if err != nil {
+		return "", err
+	}
+	if server != nil {
+		return strings.TrimSuffix(server.URL, "/"), nil
+	}
+	if path, err := ArtifactPath(u.String()); err == nil {
+		return path.base.String(), nil
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// EnvCredentials reads ARTIFACTORY_TOKEN, ARTIFACTORY_API_KEY or ARTIFACTORY_USER/ARTIFACTORY_PASSWORD.
+type EnvCredentials struct{}
+
+func (EnvCredentials) Name() string {
+	return "env"
+}
+
+func (EnvCredentials) Lookup(_ *url.URL) (*Credentials, error) {
+	return &Credentials{
+		Token:    os.Getenv("ARTIFACTORY_TOKEN"),
+		APIKey:   os.Getenv("ARTIFACTORY_API_KEY"),
+		User:     os.Getenv("ARTIFACTORY_USER"),
+		Password: os.Getenv("ARTIFACTORY_PASSWORD"),
+	}, nil
+}
+
+// NetrcCredentials reads the machine entry for the host from $NETRC or ~/.netrc.
+type NetrcCredentials struct{}
+
+func (NetrcCredentials) Name() string {
+	return "netrc"
+}
+
+func (NetrcCredentials) Lookup(u *url.URL) (*Credentials, error) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseNetrc(string(b), u.Hostname()), nil
+}
+
+func parseNetrc(content, host string) *Credentials {
+	var found, fallback *Credentials
+	var current *Credentials
+	fields := strings.Fields(content)
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			current = nil
+			if i+1 < len(fields) {
+				i++
+				if fields[i] == host && found == nil {
+					found = &Credentials{}
+					current = found
+				}
+			}
+		case "default":
+			current = nil
+			if fallback == nil {
+				fallback = &Credentials{}
+				current = fallback
+			}
+		case "login", "password", "account":
+			if i+1 >= len(fields) {
+				break
+			}
+			i++
+			if current == nil {
+				continue
+			}
+			if fields[i-1] == "login" {
+				current.User = fields[i]
+			} else if fields[i-1] == "password" {
+				current.Password = fields[i]
+			}
+		}
+	}
+	if found != nil {
+		return found
+	}
+	return fallback
+}
+
+type serverConfig struct {
+	URL              string `json:"url"`
+	CredentialHelper string `json:"credential_helper,omitempty"`
+	Credentials
+}
+
+type clientConfig struct {
+	Servers []serverConfig `json:"servers"`
+}
+
+func configPath() string {
+	if path := os.Getenv("ARTIFACTORY_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "artifactory.json"
+	}
+	return filepath.Join(dir, "usi", "artifactory.json")
+}
+
+// serverFor returns the config entry whose url matches u with the longest path. See serverMatches.
+func serverFor(u *url.URL) (*serverConfig, error) {
+	b, err := ioutil.ReadFile(configPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config clientConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, err
+	}
+	var best *serverConfig
+	bestPath := -1
+	for i, server := range config.Servers {
+		if path, ok := serverMatches(server.URL, u); ok && len(path) > bestPath {
+			best, bestPath = &config.Servers[i], len(path)
+		}
+	}
+	return best, nil
+}
+
+// serverMatches tells whether u is on the configured server: the scheme and host must be equal
+// and the server's path must be u's path or one of its parent folders. It also returns the
+// server's path so the most specific server can be picked.
+func serverMatches(serverURL string, u *url.URL) (string, bool) {
+	server, err := url.Parse(serverURL)
+	if err != nil || server.Host == "" {
+		return "", false
+	}
+	if !strings.EqualFold(server.Scheme, u.Scheme) || !strings.EqualFold(server.Host, u.Host) {
+		return "", false
+	}
+	path := strings.TrimSuffix(server.Path, "/")
+	return path, u.Path == path || strings.HasPrefix(u.Path, path+"/")
+}
+
+// ConfigCredentials reads credentials stored in the artifactory client config file.
+type ConfigCredentials struct{}
+
+func (ConfigCredentials) Name() string {
+	return "config"
+}
+
+func (ConfigCredentials) Lookup(u *url.URL) (*Credentials, error) {
+	server, err := serverFor(u)
+	if err != nil || server == nil {
+		return nil, err
+	}
+	creds := server.Credentials
+	return &creds, nil
+}
+
+// HelperCredentials runs an external executable, named by ARTIFACTORY_CREDENTIAL_HELPER
+// or the server's credential_helper config entry, as `<helper> get` with the url on stdin.
+// The helper prints a JSON object with token, api_key or username/password.
+type HelperCredentials struct{}
+
+func (HelperCredentials) Name() string {
+	return "credential helper"
+}
+
+func (HelperCredentials) Lookup(u *url.URL) (*Credentials, error) {
+	helper := os.Getenv("ARTIFACTORY_CREDENTIAL_HELPER")
+	if helper == "" {
+		server, err := serverFor(u)
+		if err != nil || server == nil {
+			return nil, err
+		}
+		helper = server.CredentialHelper
+	}
+	if helper == "" {
+		return nil, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(helper, "get")
+	cmd.Stdin = strings.NewReader(u.Scheme + "://" + u.Host + "\n")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s get: %s %s", helper, err.Error(), strings.TrimSpace(stderr.String()))
+	}
+	var creds Credentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return nil, fmt.Errorf("%s get: invalid output: %s", helper, err.Error())
+	}
+	return &creds, nil
+}
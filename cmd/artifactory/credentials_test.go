@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// isolateCredentials clears every credential source but the config file written to dir.
+func isolateCredentials(t *testing.T, config string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"ARTIFACTORY_TOKEN", "ARTIFACTORY_API_KEY", "ARTIFACTORY_USER", "ARTIFACTORY_PASSWORD", "ARTIFACTORY_CREDENTIAL_HELPER"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("NETRC", filepath.Join(dir, "netrc"))
+	t.Setenv("ARTIFACTORY_CONFIG", filepath.Join(dir, "artifactory.json"))
+	if err := os.WriteFile(filepath.Join(dir, "artifactory.json"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	credentialCache.Range(func(key, _ interface{}) bool {
+		credentialCache.Delete(key)
+		return true
+	})
+}
+
+func TestCredentialsForSharedHost(t *testing.T) {
+	isolateCredentials(t, `{"servers": [
+		{"url": "https://repo.example.com/artifactory", "token": "prod"},
+		{"url": "https://repo.example.com/artifactory-staging/", "token": "staging"}
+	]}`)
+
+	tests := []struct {
+		url   string
+		token string
+	}{
+		{url: "https://repo.example.com/artifactory/libs/app.tar.gz", token: "prod"},
+		{url: "https://repo.example.com/artifactory-staging/libs/app.tar.gz", token: "staging"},
+		{url: "https://repo.example.com/artifactory/api/storage/libs/app.tar.gz", token: "prod"},
+		{url: "https://repo.example.com/artifactory-staging/api/search/aql", token: "staging"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			creds, err := CredentialsFor(u)
+			if err != nil {
+				t.Fatalf("CredentialsFor() error = %v", err)
+			}
+			if creds.Token != tt.token || creds.Source != "config" {
+				t.Errorf("CredentialsFor() = %s token %q, want config token %q", creds.Source, creds.Token, tt.token)
+			}
+		})
+	}
+}
+
+func TestServerMatches(t *testing.T) {
+	tests := []struct {
+		server string
+		url    string
+		want   bool
+	}{
+		{server: "https://art.corp", url: "https://art.corp/artifactory/libs/app", want: true},
+		{server: "https://art.corp/", url: "https://art.corp/libs/app", want: true},
+		{server: "https://ART.corp", url: "https://art.corp/libs/app", want: true},
+		{server: "https://art.corp/artifactory", url: "https://art.corp/artifactory", want: true},
+		{server: "https://art.corp", url: "https://art.corp.evil.io/artifactory/libs/app"},
+		{server: "https://art.corp", url: "https://art.corporate/artifactory/libs/app"},
+		{server: "https://art.corp", url: "https://art.corp:8443/artifactory/libs/app"},
+		{server: "https://art.corp", url: "http://art.corp/artifactory/libs/app"},
+		{server: "https://art.corp/artifactory", url: "https://art.corp/artifactory-staging/libs/app"},
+		{server: "art.corp", url: "https://art.corp/libs/app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server+" "+tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			if _, got := serverMatches(tt.server, u); got != tt.want {
+				t.Errorf("serverMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialsForLookalikeHost(t *testing.T) {
+	isolateCredentials(t, `{"servers": [{"url": "https://art.corp", "token": "secret"}]}`)
+	for _, raw := range []string{"https://art.corp.evil.io/artifactory/libs/app", "https://art.corporate/artifactory/libs/app"} {
+		u, _ := url.Parse(raw)
+		// no other source is configured, so the lookup fails unless the config entry matched
+		if creds, err := CredentialsFor(u); err == nil && creds.Token == "secret" {
+			t.Errorf("CredentialsFor(%s) sent the art.corp token", raw)
+		}
+	}
+}
+
+func TestParseNetrc(t *testing.T) {
+	content := `
+machine other.example.com login other password secret1
+machine repo.example.com
+  login ci
+  password secret2
+default login anonymous password guest
+`
+	tests := []struct {
+		host string
+		want *Credentials
+	}{
+		{host: "repo.example.com", want: &Credentials{User: "ci", Password: "secret2"}},
+		{host: "other.example.com", want: &Credentials{User: "other", Password: "secret1"}},
+		{host: "unknown.example.com", want: &Credentials{User: "anonymous", Password: "guest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := parseNetrc(content, tt.host); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNetrc() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if got := parseNetrc("machine other.example.com login a password b", "repo.example.com"); got != nil {
+		t.Errorf("parseNetrc() without a match = %+v, want nil", got)
+	}
+}
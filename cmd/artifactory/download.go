@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+
+	cli "github.com/jawher/mow.cli"
+
+	"usi/pkg/errors"
+)
+
+func CmdDownload(app *cli.Cmd) {
+	app.Spec = "[ --offline ] [ --no-cache ] URL [ DEST ]"
+	url := app.StringArg("URL", "", "artifactory url")
+	dest := app.StringArg("DEST", "", "destination file path (defaults to the artifact name in the current directory)")
+	offline := app.BoolOpt("offline", false, "only serve the artifact from the local cache")
+	noCache := app.BoolOpt("no-cache", false, "always fetch the artifact from artifactory")
+	app.Action = func() {
+		if *dest == "" {
+			*dest = path.Base(*url)
+		}
+		cache, err := OpenCache()
+		if err != nil {
+			HandleError(err)
+		}
+		HandleError(Download(cache, *url, *dest, *offline, *noCache))
+	}
+}
+
+func Download(cache *Cache, url, dest string, offline, noCache bool) error {
+	if offline {
+		sha256Sum, ok := cache.Lookup(url)
+		if !ok {
+			return errors.WithCode(fmt.Sprintf("%s is not in the local cache", url), errors.NotFound)
+		}
+		return fromCache(cache, url, sha256Sum, dest)
+	}
+
+	if !noCache {
+		req, err := NewRequest("HEAD", url, nil)
+		if err != nil {
+			return err
+		}
+		res, err := Send(req)
+		if err != nil {
+			// artifactory is unreachable, fall back to whatever this url resolved to last time
+			if sha256Sum, ok := cache.Lookup(url); ok {
+				fmt.Printf("Unable to reach artifactory (%s), using cached copy\n", err.Error())
+				return fromCache(cache, url, sha256Sum, dest)
+			}
+			return err
+		}
+		_ = res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			if sha256Sum := res.Header.Get(HeaderChecksumSha256); cache.Has(sha256Sum) {
+				if err := cache.Record(url, sha256Sum); err != nil {
+					return err
+				}
+				return fromCache(cache, url, sha256Sum, dest)
+			}
+		}
+	}
+
+	req, err := NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := Send(req)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		if err := CheckResponse(req, res, body); err != nil {
+			return err
+		}
+		return errors.WithCode(fmt.Sprintf("unable to download %s: %s", url, res.Status), errors.BadRequest)
+	}
+
+	tmp, err := cache.TempFile()
+	if err != nil {
+		return err
+	}
+	defer func(name string) {
+		_ = os.Remove(name)
+	}(tmp.Name())
+
+	checksums, size, err := ComputeChecksums(io.TeeReader(res.Body, tmp))
+	_ = tmp.Close()
+	if err != nil {
+		return err
+	}
+	expected := ChecksumsFromHeaders(res.Header)
+	if expected.IsEmpty() {
+		return errors.WithCode(fmt.Sprintf("artifactory did not report checksums for %s", url), errors.BadRequest)
+	}
+	if err := checksums.Verify(expected); err != nil {
+		return errors.WithCode(fmt.Sprintf("downloaded %s is corrupt: %s", url, err.Error()), errors.BadRequest)
+	}
+
+	if err := cache.Store(url, checksums.Sha256, tmp.Name()); err != nil {
+		return err
+	}
+	if err := cache.CopyTo(checksums.Sha256, dest); err != nil {
+		return err
+	}
+	fmt.Printf("Downloaded %s to %s (%d bytes, sha256:%s)\n", url, dest, size, checksums.Sha256)
+	return nil
+}
+
+func fromCache(cache *Cache, url, sha256Sum, dest string) error {
+	if err := cache.CopyTo(sha256Sum, dest); err != nil {
+		return err
+	}
+	fmt.Printf("Copied %s to %s from cache (sha256:%s)\n", url, dest, sha256Sum)
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"usi/pkg/errors"
+)
+
+func TestDownload(t *testing.T) {
+	server := newTestServer(t)
+	server.Put("libs/app/app.tar.gz", []byte("app content"), time.Now(), nil)
+	cache := &Cache{dir: t.TempDir()}
+	dest := t.TempDir()
+
+	tests := []struct {
+		name     string
+		repoPath string
+		offline  bool
+		noCache  bool
+		gets     int
+		heads    int
+		code     errors.Code
+	}{
+		{name: "offline before the first download", repoPath: "libs/app/app.tar.gz", offline: true, code: errors.NotFound},
+		{name: "first download", repoPath: "libs/app/app.tar.gz", heads: 1, gets: 1},
+		{name: "served from cache", repoPath: "libs/app/app.tar.gz", heads: 1},
+		{name: "offline", repoPath: "libs/app/app.tar.gz", offline: true},
+		{name: "no cache", repoPath: "libs/app/app.tar.gz", noCache: true, gets: 1},
+		{name: "missing", repoPath: "libs/app/missing.tar.gz", heads: 1, gets: 1, code: errors.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(server.Requests())
+			path := filepath.Join(dest, tt.name, "app.tar.gz")
+			err := Download(cache, server.ArtifactURL(tt.repoPath), path, tt.offline, tt.noCache)
+
+			requests := server.Requests()[before:]
+			if gets := countMethod(requests, http.MethodGet); gets != tt.gets {
+				t.Errorf("Download() sent %d GETs, want %d", gets, tt.gets)
+			}
+			if heads := countMethod(requests, http.MethodHead); heads != tt.heads {
+				t.Errorf("Download() sent %d HEADs, want %d", heads, tt.heads)
+			}
+			if tt.code != errors.Unexpected {
+				if errorCode(err) != tt.code {
+					t.Fatalf("Download() error = %v, want code %v", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if got, _ := os.ReadFile(path); string(got) != "app content" {
+				t.Errorf("downloaded %q, want %q", got, "app content")
+			}
+		})
+	}
+}
+
+func TestDownloadFallsBackToCacheWhenUnreachable(t *testing.T) {
+	server := newTestServer(t)
+	server.Put("libs/app/app.tar.gz", []byte("app content"), time.Now(), nil)
+	cache := &Cache{dir: t.TempDir()}
+	url := server.ArtifactURL("libs/app/app.tar.gz")
+	if err := Download(cache, url, filepath.Join(t.TempDir(), "first"), false, false); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	server.Close()
+	dest := filepath.Join(t.TempDir(), "second")
+	if err := Download(cache, url, dest, false, false); err != nil {
+		t.Fatalf("Download() with artifactory down error = %v", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != "app content" {
+		t.Errorf("downloaded %q, want the cached content", got)
+	}
+}
+
+func TestDownloadIgnoresInvalidServerSha256(t *testing.T) {
+	content := []byte("app content")
+	checksums, _, err := ComputeChecksums(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		sha256 string
+	}{
+		{name: "path traversal", sha256: "../../../../etc/passwd"},
+		{name: "empty", sha256: ""},
+		{name: "uppercase", sha256: strings.ToUpper(checksums.Sha256)},
+		{name: "too short", sha256: checksums.Sha256[:63]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gets := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead {
+					w.Header().Set(HeaderChecksumSha256, tt.sha256)
+					return
+				}
+				gets++
+				checksums.SetHeaders(w.Header())
+				_, _ = w.Write(content)
+			}))
+			defer server.Close()
+			t.Setenv("ARTIFACTORY_TOKEN", "test-token")
+			cache := &Cache{dir: t.TempDir()}
+
+			dest := filepath.Join(t.TempDir(), "app.tar.gz")
+			if err := Download(cache, server.URL+"/artifactory/libs/app.tar.gz", dest, false, false); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if gets != 1 {
+				t.Errorf("Download() sent %d GETs, want the invalid sha256 to be a cache miss", gets)
+			}
+			if got, _ := os.ReadFile(dest); !bytes.Equal(got, content) {
+				t.Errorf("downloaded %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+func TestCacheRejectsInvalidSha256(t *testing.T) {
+	cache := &Cache{dir: t.TempDir()}
+	for _, sha256Sum := range []string{"", "..", "../" + strings.Repeat("a", 61), strings.Repeat("A", 64), strings.Repeat("g", 64)} {
+		if cache.Has(sha256Sum) {
+			t.Errorf("Has(%q) = true", sha256Sum)
+		}
+		if err := cache.Record("https://art/libs/app", sha256Sum); err == nil {
+			t.Errorf("Record(%q) succeeded", sha256Sum)
+		}
+		if err := cache.CopyTo(sha256Sum, filepath.Join(t.TempDir(), "dest")); err == nil {
+			t.Errorf("CopyTo(%q) succeeded", sha256Sum)
+		}
+	}
+}
@@ -1,10 +1,6 @@
 package main
 
 import (
-	"bufio"
-	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
 
@@ -27,81 +23,35 @@ func HandleError(err error) {
 	}
 }
 
-func CmdUpload(app *cli.Cmd) {
-	path := app.StringArg("PATH", "", "artifact file path")
+func CmdDelete(app *cli.Cmd) {
 	url := app.StringArg("URL", "", "artifactory url")
 	app.Action = func() {
-		f, err := os.Open(*path)
-		if err != nil {
-			HandleError(err)
-		}
-		defer func(f *os.File) {
-			_ = f.Close()
-		}(f)
-
-		payload := bufio.NewReader(f)
-		req, err := http.NewRequest("PUT", *url, payload)
+		res, body, err := Delete(*url)
 		if err != nil {
 			HandleError(err)
 		}
-		token := os.Getenv("ARTIFACTORY_TOKEN")
-		if token == "" {
-			HandleError(errors.New("env var ARTIFACTORY_TOKEN is required"))
-		}
-		req.Header.Add("Content-Type", "application/octet-stream")
-		req.Header.Add("Authorization", "Bearer "+token)
-		res, err := http.DefaultClient.Do(req)
-		if err != nil {
-			HandleError(err)
-		}
-
-		defer func(Body io.ReadCloser) {
-			_ = Body.Close()
-		}(res.Body)
-		body, err := ioutil.ReadAll(res.Body)
-		if err != nil {
-			HandleError(err)
-		}
-
-		fmt.Println(res)
-		fmt.Println(string(body))
+		PrintResponse(res, body)
 	}
 }
 
-func CmdDelete(app *cli.Cmd) {
-	url := app.StringArg("URL", "", "artifactory url")
-	app.Action = func() {
-		req, err := http.NewRequest("DELETE", *url, nil)
-		if err != nil {
-			HandleError(err)
-		}
-		token := os.Getenv("ARTIFACTORY_TOKEN")
-		if token == "" {
-			HandleError(errors.New("env var ARTIFACTORY_TOKEN is required"))
-		}
-		req.Header.Add("Content-Type", "application/octet-stream")
-		req.Header.Add("Authorization", "Bearer "+token)
-		res, err := http.DefaultClient.Do(req)
-		if err != nil {
-			HandleError(err)
-		}
-
-		defer func(Body io.ReadCloser) {
-			_ = Body.Close()
-		}(res.Body)
-		body, err := ioutil.ReadAll(res.Body)
-		if err != nil {
-			HandleError(err)
-		}
-
-		fmt.Println(res)
-		fmt.Println(string(body))
+func Delete(url string) (*http.Response, []byte, error) {
+	req, err := NewRequest("DELETE", url, nil)
+	if err != nil {
+		return nil, nil, err
 	}
+	return Do(req)
 }
 
 func main() {
 	app := cli.App("Artifactory", "Artifactory Client")
 	app.Command("upload", "upload an artifact to artifactory", CmdUpload)
+	app.Command("download", "download an artifact from artifactory", CmdDownload)
 	app.Command("delete", "delete artifact on artifactory", CmdDelete)
+	app.Command("search list", "search or list artifacts in a repository", CmdSearch)
+	app.Command("props", "manage artifact properties", CmdProps)
+	app.Command("copy", "copy artifacts between repositories on the server", CmdCopy)
+	app.Command("move", "move artifacts between repositories on the server", CmdMove)
+	app.Command("promote", "promote a build to another repository, optionally stamping properties", CmdPromote)
+	app.Command("cleanup", "delete old artifacts by age or by keeping the newest per folder", CmdCleanup)
 	_ = app.Run(os.Args)
 }
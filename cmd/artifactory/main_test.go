@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"usi/cmd/artifactory/artifactorytest"
+	"usi/pkg/errors"
+)
+
+// newTestServer starts a fake artifactory and points the env credentials at it.
+func newTestServer(t *testing.T) *artifactorytest.Server {
+	t.Helper()
+	server := artifactorytest.NewServer()
+	server.Token = "test-token"
+	t.Cleanup(server.Close)
+	t.Setenv("ARTIFACTORY_TOKEN", server.Token)
+	return server
+}
+
+func countMethod(requests []artifactorytest.Request, method string) int {
+	n := 0
+	for _, r := range requests {
+		if r.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+func errorCode(err error) errors.Code {
+	if e, ok := err.(*errors.Error); ok {
+		return e.Code
+	}
+	return errors.Unexpected
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"usi/pkg/errors"
+)
+
+const (
+	bytesPerMiB = 1024 * 1024
+
+	// uploadsAPI is artifactory's multipart upload api. The parts go straight to the
+	// urls it hands out, and artifactory assembles them once the upload is completed.
+	uploadsAPI = "/api/v1/uploads/"
+
+	multipartFinished = "FINISHED"
+	multipartAborted  = "ABORTED"
+)
+
+// multipartPollInterval is how often the assembly of a completed upload is checked.
+var multipartPollInterval = time.Second
+
+// errMultipartUnsupported is returned when the server has no multipart upload api, so the
+// file has to be sent in a single request.
+var errMultipartUnsupported = errors.WithCode("artifactory does not support multipart uploads", errors.NotImplemented)
+
+// multipartState records a multipart upload and the parts artifactory already acknowledged,
+// so an interrupted upload can be continued by rerunning it.
+type multipartState struct {
+	URL      string         `json:"url"`
+	Sha256   string         `json:"sha256"`
+	Size     int64          `json:"size"`
+	PartSize int64          `json:"part_size"`
+	Token    string         `json:"token"`
+	Parts    map[int]string `json:"parts"`
+}
+
+func (s *multipartState) matches(url string, checksums *Checksums, size, partSize int64) bool {
+	return s.URL == url && s.Sha256 == checksums.Sha256 && s.Size == size && s.PartSize == partSize && s.Token != ""
+}
+
+// UploadMultipart uploads path in parts of partSize bytes through artifactory's multipart
+// upload api. Every acknowledged part is recorded, and when the upload stops a rerun only
+// sends the missing parts. It returns errMultipartUnsupported when the server doesn't offer
+// the api.
+func UploadMultipart(path, artifactURL string, checksums *Checksums, size, partSize int64) (*http.Response, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	target, err := ArtifactPath(artifactURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	statePath, err := multipartStatePath(artifactURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := int((size + partSize - 1) / partSize)
+	state := loadMultipartState(statePath)
+	resumed := state != nil && state.matches(artifactURL, checksums, size, partSize)
+	if resumed {
+		fmt.Printf("Resuming upload of %s with %d/%d parts already uploaded\n", path, len(state.Parts), parts)
+	} else {
+		state = &multipartState{URL: artifactURL, Sha256: checksums.Sha256, Size: size, PartSize: partSize, Parts: map[int]string{}}
+		if state.Token, err = createMultipartUpload(target, partSize); err != nil {
+			return nil, nil, err
+		}
+		if err := saveMultipartState(statePath, state); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for part := 1; part <= parts; part++ {
+		if _, ok := state.Parts[part]; ok {
+			continue
+		}
+		offset := int64(part-1) * partSize
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+		etag, err := uploadPart(target, state.Token, part, f, offset, length)
+		if err != nil && resumed && (errorCodeOf(err) == errors.NotFound || errorCodeOf(err) == errors.Unauthorized) {
+			// artifactory no longer knows the upload, e.g. its token expired
+			fmt.Printf("The interrupted upload of %s expired, starting over\n", path)
+			_ = os.Remove(statePath)
+			return UploadMultipart(path, artifactURL, checksums, size, partSize)
+		}
+		if err != nil {
+			fmt.Printf("Upload of %s stopped at part %d/%d, rerun to resume\n", path, part, parts)
+			return nil, nil, err
+		}
+		state.Parts[part] = etag
+		if err := saveMultipartState(statePath, state); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	res, body, err := completeMultipartUpload(target, state.Token, checksums)
+	if err != nil {
+		return nil, nil, err
+	}
+	_ = os.Remove(statePath)
+	return res, body, nil
+}
+
+func errorCodeOf(err error) errors.Code {
+	if e, ok := err.(*errors.Error); ok {
+		return e.Code
+	}
+	return errors.Unexpected
+}
+
+func uploadsURL(target *artifactPath, action string, query url.Values) string {
+	u := *target.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + uploadsAPI + action
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// uploadsRequest calls the multipart upload api. Once an upload is created it is
+// authorized by its token rather than the user's credentials.
+func uploadsRequest(target *artifactPath, token, action string, query url.Values, result interface{}) (*http.Response, []byte, error) {
+	req, err := NewRequest("POST", uploadsURL(target, action, query), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token != "" {
+		req.Header.Del("X-JFrog-Art-Api")
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, body, err := Do(req)
+	if err != nil || result == nil {
+		return res, body, err
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return res, body, fmt.Errorf("invalid %s response from %s: %s", action, req.URL, err.Error())
+	}
+	return res, body, nil
+}
+
+func createMultipartUpload(target *artifactPath, partSize int64) (string, error) {
+	repoKey, repoPath, _ := strings.Cut(target.repoPath, "/")
+	query := url.Values{}
+	query.Set("repoKey", repoKey)
+	query.Set("repoPath", repoPath)
+	query.Set("partSizeMB", strconv.FormatInt((partSize+bytesPerMiB-1)/bytesPerMiB, 10))
+	var created struct {
+		Token string `json:"token"`
+	}
+	res, _, err := uploadsRequest(target, "", "create", query, &created)
+	if res != nil && (res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusNotImplemented) {
+		return "", errMultipartUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+	if created.Token == "" {
+		return "", errors.WithCode("artifactory returned no multipart upload token", errors.Unexpected)
+	}
+	return created.Token, nil
+}
+
+// uploadPart sends one part to the url artifactory generates for it and returns its ETag.
+// The part url is pre-signed, so no credentials are sent along.
+func uploadPart(target *artifactPath, token string, part int, f *os.File, offset, length int64) (string, error) {
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(part))
+	var partURL struct {
+		URL string `json:"url"`
+	}
+	if _, _, err := uploadsRequest(target, token, "urlPart", query, &partURL); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("PUT", partURL.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	setFileBody(req, f, offset, length)
+	res, _, err := Do(req)
+	if err != nil {
+		return "", err
+	}
+	return res.Header.Get("ETag"), nil
+}
+
+// completeMultipartUpload asks artifactory to assemble the parts and waits until it has
+// verified them against the sha1 and stored the artifact.
+func completeMultipartUpload(target *artifactPath, token string, checksums *Checksums) (*http.Response, []byte, error) {
+	query := url.Values{}
+	query.Set("sha1", checksums.Sha1)
+	if _, _, err := uploadsRequest(target, token, "complete", query, nil); err != nil {
+		return nil, nil, err
+	}
+	for {
+		var status struct {
+			Status   string `json:"status"`
+			Error    string `json:"error"`
+			Progress int    `json:"progress"`
+		}
+		res, body, err := uploadsRequest(target, token, "status", nil, &status)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch status.Status {
+		case multipartFinished:
+			return res, body, nil
+		case multipartAborted:
+			return res, body, errors.WithCode(fmt.Sprintf("multipart upload of %s was aborted: %s", target.repoPath, status.Error), errors.Conflict)
+		}
+		time.Sleep(multipartPollInterval)
+	}
+}
+
+func multipartStatePath(url string) (string, error) {
+	cacheDir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "uploads", hashURL(url)+".json"), nil
+}
+
+func loadMultipartState(path string) *multipartState {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state multipartState
+	if err := json.Unmarshal(b, &state); err != nil || state.Parts == nil {
+		return nil
+	}
+	return &state
+}
+
+func saveMultipartState(path string, state *multipartState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0o644)
+}
+
+// setFileBody sends the given section of f as the request body and lets Send rewind it on
+// retries, so a retry only re-sends that section.
+func setFileBody(req *http.Request, f *os.File, offset, length int64) {
+	req.Body = io.NopCloser(io.NewSectionReader(f, offset, length))
+	req.ContentLength = length
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(io.NewSectionReader(f, offset, length)), nil
+	}
+}
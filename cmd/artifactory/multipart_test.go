@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"usi/cmd/artifactory/artifactorytest"
+)
+
+// partPuts counts the multipart upload parts sent.
+func partPuts(requests []artifactorytest.Request) int {
+	puts := 0
+	for _, r := range requests {
+		if r.Method == http.MethodPut && strings.HasPrefix(r.Path, "/_parts/") {
+			puts++
+		}
+	}
+	return puts
+}
+
+// artifactPuts counts the PUTs that sent the whole file to the artifact's url.
+func artifactPuts(requests []artifactorytest.Request) int {
+	puts := 0
+	for _, r := range requests {
+		if r.Method == http.MethodPut && strings.HasPrefix(r.Path, "/artifactory/libs/") {
+			puts++
+		}
+	}
+	return puts
+}
+
+func newMultipartServer(t *testing.T) *artifactorytest.Server {
+	t.Helper()
+	server := newTestServer(t)
+	server.MultipartUploads = true
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	return server
+}
+
+func TestUploadFileMultipart(t *testing.T) {
+	content := "0123456789"
+	tests := []struct {
+		name      string
+		multipart bool
+		opts      UploadOptions
+		partPuts  int
+		bodyPuts  int
+	}{
+		{name: "in parts", multipart: true, opts: UploadOptions{PartSize: 4}, partPuts: 3},
+		{name: "exact parts", multipart: true, opts: UploadOptions{PartSize: 5}, partPuts: 2},
+		{name: "smaller than a part", multipart: true, opts: UploadOptions{PartSize: 64}, bodyPuts: 1},
+		{name: "in parts with properties", multipart: true, partPuts: 3,
+			opts: UploadOptions{PartSize: 4, Properties: map[string]string{"build": "42"}}},
+		{name: "server without multipart uploads", opts: UploadOptions{PartSize: 4}, bodyPuts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMultipartServer(t)
+			server.MultipartUploads = tt.multipart
+			path := writeFile(t, filepath.Join(t.TempDir(), "app.tar.gz"), content)
+
+			if _, err := UploadFile(Target{Path: path, URL: server.ArtifactURL("libs/app.tar.gz")}, tt.opts); err != nil {
+				t.Fatalf("UploadFile() error = %v", err)
+			}
+			requests := server.Requests()
+			if puts := partPuts(requests); puts != tt.partPuts {
+				t.Errorf("UploadFile() sent %d parts, want %d", puts, tt.partPuts)
+			}
+			if puts := artifactPuts(requests); puts != tt.bodyPuts {
+				t.Errorf("UploadFile() sent %d full-body PUTs, want %d", puts, tt.bodyPuts)
+			}
+			if got, _ := server.Content("libs/app.tar.gz"); string(got) != content {
+				t.Errorf("stored content = %q, want %q", got, content)
+			}
+			item := server.Item("libs/app.tar.gz")
+			for key, value := range tt.opts.Properties {
+				if !reflect.DeepEqual(item.Properties[key], []string{value}) {
+					t.Errorf("property %s = %v, want %s", key, item.Properties[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadFileMultipartResumes(t *testing.T) {
+	content := strings.Repeat("a", 4) + strings.Repeat("b", 4) + strings.Repeat("c", 4) + strings.Repeat("d", 4)
+	tests := []struct {
+		name string
+		// expire drops the interrupted upload on the server before the rerun
+		expire        bool
+		rerunPartPuts int
+		token         string
+	}{
+		{name: "resumes the missing parts", rerunPartPuts: 2, token: "upload-1"},
+		{name: "starts over when the upload expired", expire: true, rerunPartPuts: 4, token: "upload-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMultipartServer(t)
+			server.InjectFault(artifactorytest.Fault{Method: http.MethodPut, PathPrefix: "/_parts/upload-1/3", Status: http.StatusInternalServerError, Count: 1})
+			path := writeFile(t, filepath.Join(t.TempDir(), "app.tar.gz"), content)
+			target := Target{Path: path, URL: server.ArtifactURL("libs/app.tar.gz")}
+			opts := UploadOptions{PartSize: 4}
+
+			if _, err := UploadFile(target, opts); err == nil {
+				t.Fatal("UploadFile() succeeded despite the failing part")
+			}
+			if parts := server.Upload("upload-1"); parts != 2 {
+				t.Fatalf("server received %d parts before the failure, want 2", parts)
+			}
+			if tt.expire {
+				server.ExpireUploads()
+			}
+
+			before := len(server.Requests())
+			if _, err := UploadFile(target, opts); err != nil {
+				t.Fatalf("UploadFile() rerun error = %v", err)
+			}
+			if puts := partPuts(server.Requests()[before:]); puts != tt.rerunPartPuts {
+				t.Errorf("rerun sent %d parts, want %d", puts, tt.rerunPartPuts)
+			}
+			if parts := server.Upload(tt.token); parts != 4 {
+				t.Errorf("upload %s has %d parts, want 4", tt.token, parts)
+			}
+			if got, _ := server.Content("libs/app.tar.gz"); string(got) != content {
+				t.Errorf("stored content = %q, want %q", got, content)
+			}
+
+			// a completed upload leaves nothing to resume
+			before = len(server.Requests())
+			if _, err := UploadFile(target, opts); err != nil {
+				t.Fatalf("UploadFile() third run error = %v", err)
+			}
+			if puts := partPuts(server.Requests()[before:]); puts != 4 {
+				t.Errorf("a fresh upload sent %d parts, want 4", puts)
+			}
+		})
+	}
+}
+
+func TestUploadMultipartRejectsCorruptAssembly(t *testing.T) {
+	server := newMultipartServer(t)
+	path := writeFile(t, filepath.Join(t.TempDir(), "app.tar.gz"), "0123456789")
+	checksums, size, err := FileChecksums(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksums.Sha1 = strings.Repeat("0", 40)
+
+	_, _, err = UploadMultipart(path, server.ArtifactURL("libs/app.tar.gz"), checksums, size, 4)
+	if err == nil || !strings.Contains(err.Error(), "aborted") {
+		t.Fatalf("UploadMultipart() error = %v, want the upload aborted", err)
+	}
+	if server.Item("libs/app.tar.gz") != nil {
+		t.Error("the corrupt artifact was stored")
+	}
+}
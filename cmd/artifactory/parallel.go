@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"usi/pkg/errors"
+)
+
+// Target is a local file and the artifactory url it maps to.
+type Target struct {
+	Path string
+	URL  string
+}
+
+// CollectTargets expands PATH into the files to upload. A plain file keeps the url as is,
+// while files found under a directory or glob are placed under the url by their relative path.
+func CollectTargets(pattern, baseURL string) ([]Target, bool, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, false, err
+		}
+		if !info.IsDir() {
+			return []Target{{Path: pattern, URL: baseURL}}, true, nil
+		}
+		targets, err := walkTargets(pattern, pattern, baseURL)
+		return targets, false, err
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, false, err
+	}
+	root := globRoot(pattern)
+	var targets []Target
+	for _, match := range matches {
+		found, err := walkTargets(root, match, baseURL)
+		if err != nil {
+			return nil, false, err
+		}
+		targets = append(targets, found...)
+	}
+	if len(targets) == 0 {
+		return nil, false, errors.WithCode(fmt.Sprintf("no files match %s", pattern), errors.NotFound)
+	}
+	return targets, false, nil
+}
+
+func walkTargets(root, path, baseURL string) ([]Target, error) {
+	var targets []Target
+	err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, Target{Path: file, URL: JoinURL(baseURL, filepath.ToSlash(rel))})
+		return nil
+	})
+	return targets, err
+}
+
+// globRoot is the directory part of a glob before its first wildcard.
+func globRoot(pattern string) string {
+	prefix := pattern[:strings.IndexAny(pattern, "*?[")]
+	if i := strings.LastIndex(prefix, string(filepath.Separator)); i >= 0 {
+		return prefix[:i+1]
+	}
+	return "."
+}
+
+func JoinURL(baseURL, relPath string) string {
+	segments := strings.Split(relPath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + strings.Join(segments, "/")
+}
+
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// RunParallel calls fn for every input on at most jobs goroutines and returns the
+// results in input order.
+func RunParallel[I any, O any](inputs []I, jobs int, fn func(I) (O, error)) []Result[O] {
+	if jobs < 1 {
+		jobs = 1
+	}
+	results := make([]Result[O], len(inputs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				value, err := fn(inputs[i])
+				results[i] = Result[O]{Value: value, Err: err}
+			}
+		}()
+	}
+	for i := range inputs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+const progressWidth = 30
+
+type Progress struct {
+	mu     sync.Mutex
+	total  int
+	done   int
+	failed int
+	bytes  int64
+	start  time.Time
+}
+
+func NewProgress(total int) *Progress {
+	return &Progress{total: total, start: time.Now()}
+}
+
+func (p *Progress) Add(bytes int64, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if ok {
+		p.bytes += bytes
+	} else {
+		p.failed++
+	}
+	p.render()
+}
+
+func (p *Progress) render() {
+	filled := 0
+	if p.total > 0 {
+		filled = p.done * progressWidth / p.total
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+	_, _ = fmt.Fprintf(os.Stderr, "\r[%s] %d/%d files, %s, %d failed, %s",
+		bar, p.done, p.total, FormatBytes(p.bytes), p.failed, time.Since(p.start).Round(time.Second))
+}
+
+func (p *Progress) Done() {
+	_, _ = fmt.Fprintln(os.Stderr)
+}
+
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	cli "github.com/jawher/mow.cli"
+
+	"usi/pkg/errors"
+)
+
+func CmdProps(app *cli.Cmd) {
+	app.Command("set", "set properties on an artifact or folder", CmdPropsSet)
+	app.Command("get", "get the properties of an artifact or folder", CmdPropsGet)
+	app.Command("delete", "delete properties from an artifact or folder", CmdPropsDelete)
+}
+
+func CmdPropsSet(app *cli.Cmd) {
+	app.Spec = "[ -r ] URL PROPERTIES..."
+	artifactURL := app.StringArg("URL", "", "artifactory url of the artifact or folder")
+	props := app.StringsArg("PROPERTIES", nil, "key=value pairs to set")
+	recursive := app.BoolOpt("r recursive", false, "apply to everything under a folder")
+	app.Action = func() {
+		properties, err := ParseProperties(*props)
+		if err != nil {
+			HandleError(err)
+		}
+		HandleError(SetProperties(*artifactURL, properties, *recursive))
+		fmt.Printf("Set %s on %s\n", FormatProperties(properties), *artifactURL)
+	}
+}
+
+func CmdPropsGet(app *cli.Cmd) {
+	app.Spec = "[ --json ] URL [ KEYS... ]"
+	artifactURL := app.StringArg("URL", "", "artifactory url of the artifact or folder")
+	keys := app.StringsArg("KEYS", nil, "only these property keys")
+	asJSON := app.BoolOpt("json", false, "print properties as JSON")
+	app.Action = func() {
+		properties, err := GetProperties(*artifactURL, *keys)
+		if err != nil {
+			HandleError(err)
+		}
+		if *asJSON {
+			b, err := json.MarshalIndent(properties, "", "  ")
+			if err != nil {
+				HandleError(err)
+			}
+			fmt.Println(string(b))
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "KEY\tVALUE")
+		for _, key := range sortedKeys(properties) {
+			_, _ = fmt.Fprintf(w, "%s\t%s\n", key, strings.Join(properties[key], ","))
+		}
+		_ = w.Flush()
+	}
+}
+
+func CmdPropsDelete(app *cli.Cmd) {
+	app.Spec = "[ -r ] URL KEYS..."
+	artifactURL := app.StringArg("URL", "", "artifactory url of the artifact or folder")
+	keys := app.StringsArg("KEYS", nil, "property keys to delete")
+	recursive := app.BoolOpt("r recursive", false, "apply to everything under a folder")
+	app.Action = func() {
+		HandleError(DeleteProperties(*artifactURL, *keys, *recursive))
+		fmt.Printf("Deleted %s from %s\n", strings.Join(*keys, ","), *artifactURL)
+	}
+}
+
+// StorageURL maps an artifact url (https://host/artifactory/repo/path) to its storage
+// api url (https://host/artifactory/api/storage/repo/path).
+func StorageURL(artifactURL string) (*url.URL, error) {
+	u, err := ArtifactPath(artifactURL)
+	if err != nil {
+		return nil, err
+	}
+	u.base.Path = strings.TrimSuffix(u.base.Path, "/") + "/api/storage/" + u.repoPath
+	return u.base, nil
+}
+
+type artifactPath struct {
+	base     *url.URL
+	repoPath string
+}
+
+// ArtifactPath splits an artifact url into the artifactory base url and the repo/path part.
+// The base ends at the /artifactory context path when there is one, otherwise at the host.
+func ArtifactPath(artifactURL string) (*artifactPath, error) {
+	u, err := url.Parse(artifactURL)
+	if err != nil {
+		return nil, err
+	}
+	path := u.Path
+	base := ""
+	if i := strings.Index(path, "/artifactory/"); i >= 0 {
+		base, path = path[:i+len("/artifactory")], path[i+len("/artifactory/"):]
+	}
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, errors.WithCode(fmt.Sprintf("%s does not include a repository", artifactURL), errors.BadRequest)
+	}
+	u.Path, u.RawPath, u.RawQuery = base, "", ""
+	return &artifactPath{base: u, repoPath: path}, nil
+}
+
+func SetProperties(artifactURL string, properties map[string]string, recursive bool) error {
+	return propertiesRequest("PUT", artifactURL, FormatProperties(properties), recursive)
+}
+
+func DeleteProperties(artifactURL string, keys []string, recursive bool) error {
+	return propertiesRequest("DELETE", artifactURL, strings.Join(keys, ","), recursive)
+}
+
+func GetProperties(artifactURL string, keys []string) (map[string][]string, error) {
+	u, err := StorageURL(artifactURL)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = "properties"
+	if len(keys) > 0 {
+		u.RawQuery += "=" + url.QueryEscape(strings.Join(keys, ","))
+	}
+	req, err := NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, body, err := Do(req)
+	if res != nil && res.StatusCode == http.StatusNotFound && err != nil {
+		// artifactory answers 404 both for a missing item and for an item without properties,
+		// so look the item itself up to tell them apart
+		u.RawQuery = ""
+		req, err := NewRequest("GET", u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err := Do(req); err != nil {
+			return nil, err
+		}
+		return map[string][]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Properties map[string][]string `json:"properties"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return result.Properties, nil
+}
+
+func propertiesRequest(method, artifactURL, properties string, recursive bool) error {
+	u, err := StorageURL(artifactURL)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("properties", properties)
+	if recursive {
+		query.Set("recursive", "1")
+	} else {
+		query.Set("recursive", "0")
+	}
+	u.RawQuery = query.Encode()
+	req, err := NewRequest(method, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	_, _, err = Do(req)
+	return err
+}
+
+// FormatProperties renders properties as artifactory's key=value;key=value list, escaping
+// the characters it treats as separators.
+func FormatProperties(properties map[string]string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `,`, `\,`, `|`, `\|`, `=`, `\=`, `;`, `\;`)
+	pairs := make([]string, 0, len(properties))
+	for _, key := range sortedKeys(properties) {
+		pairs = append(pairs, escaper.Replace(key)+"="+escaper.Replace(properties[key]))
+	}
+	return strings.Join(pairs, ";")
+}
+
+// MatrixParams renders properties as ;key=value matrix parameters to append to a deploy url.
+func MatrixParams(properties map[string]string) string {
+	escape := func(s string) string {
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	params := ""
+	for _, key := range sortedKeys(properties) {
+		params += ";" + escape(key) + "=" + escape(properties[key])
+	}
+	return params
+}
+
+func ParseProperties(values []string) (map[string]string, error) {
+	properties := make(map[string]string, len(values))
+	for _, value := range values {
+		key, v, found := strings.Cut(value, "=")
+		if !found || key == "" {
+			return nil, errors.WithCode(fmt.Sprintf("invalid property %q: expected key=value", value), errors.BadRequest)
+		}
+		properties[key] = v
+	}
+	return properties, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
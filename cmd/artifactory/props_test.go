@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"usi/pkg/errors"
+)
+
+func TestGetProperties(t *testing.T) {
+	server := newTestServer(t)
+	server.Put("libs/app/1.0/app.tar.gz", []byte("app"), time.Now(), map[string]string{"build": "42", "branch": "main"})
+	server.Put("libs/app/1.0/app.pom", []byte("pom"), time.Now(), nil)
+
+	tests := []struct {
+		name     string
+		repoPath string
+		keys     []string
+		want     map[string][]string
+		code     errors.Code
+	}{
+		{name: "all", repoPath: "libs/app/1.0/app.tar.gz", want: map[string][]string{"build": {"42"}, "branch": {"main"}}},
+		{name: "keys", repoPath: "libs/app/1.0/app.tar.gz", keys: []string{"build"}, want: map[string][]string{"build": {"42"}}},
+		{name: "no properties", repoPath: "libs/app/1.0/app.pom", want: map[string][]string{}},
+		{name: "folder", repoPath: "libs/app/1.0", want: map[string][]string{}},
+		{name: "missing", repoPath: "libs/app/2.0/app.tar.gz", code: errors.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetProperties(server.ArtifactURL(tt.repoPath), tt.keys)
+			if tt.code != errors.Unexpected {
+				if errorCode(err) != tt.code {
+					t.Fatalf("GetProperties() error = %v, want code %v", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetProperties() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetProperties() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAndDeleteProperties(t *testing.T) {
+	server := newTestServer(t)
+	server.Put("libs/app/1.0/app.tar.gz", []byte("app"), time.Now(), map[string]string{"build": "42"})
+	server.Put("libs/app/1.0/app.pom", []byte("pom"), time.Now(), nil)
+	folder := server.ArtifactURL("libs/app/1.0")
+	file := server.ArtifactURL("libs/app/1.0/app.tar.gz")
+
+	if err := SetProperties(folder, map[string]string{"release": "1.0", "note": "a;b=c"}, true); err != nil {
+		t.Fatalf("SetProperties() error = %v", err)
+	}
+	for _, repoPath := range []string{"libs/app/1.0/app.tar.gz", "libs/app/1.0/app.pom"} {
+		properties := server.Item(repoPath).Properties
+		if !reflect.DeepEqual(properties["release"], []string{"1.0"}) || !reflect.DeepEqual(properties["note"], []string{"a;b=c"}) {
+			t.Errorf("%s properties = %v after a recursive set", repoPath, properties)
+		}
+	}
+
+	if err := DeleteProperties(file, []string{"build", "note"}, false); err != nil {
+		t.Fatalf("DeleteProperties() error = %v", err)
+	}
+	got, err := GetProperties(file, nil)
+	if err != nil {
+		t.Fatalf("GetProperties() error = %v", err)
+	}
+	if want := map[string][]string{"release": {"1.0"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetProperties() after delete = %v, want %v", got, want)
+	}
+
+	if err := SetProperties(server.ArtifactURL("libs/app/2.0/app.tar.gz"), map[string]string{"release": "2.0"}, false); errorCode(err) != errors.NotFound {
+		t.Errorf("SetProperties() on a missing item error = %v, want not found", err)
+	}
+}
+
+func TestMatrixParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]string
+		want       string
+	}{
+		{name: "none", properties: nil, want: ""},
+		{name: "sorted", properties: map[string]string{"build": "42", "branch": "main"}, want: ";branch=main;build=42"},
+		{name: "escaped", properties: map[string]string{"note": "a b;c=d/e"}, want: ";note=a%20b%3Bc%3Dd%2Fe"},
+		{name: "empty value", properties: map[string]string{"flag": ""}, want: ";flag="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatrixParams(tt.properties); got != tt.want {
+				t.Errorf("MatrixParams() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatProperties(t *testing.T) {
+	got := FormatProperties(map[string]string{"b": "x,y", "a": `c=d;e\f|g`})
+	if want := `a=c\=d\;e\\f\|g;b=x\,y`; got != want {
+		t.Errorf("FormatProperties() = %q, want %q", got, want)
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "none", values: nil, want: map[string]string{}},
+		{name: "pairs", values: []string{"build=42", "branch=main"}, want: map[string]string{"build": "42", "branch": "main"}},
+		{name: "value with equals", values: []string{"expr=a=b"}, want: map[string]string{"expr": "a=b"}},
+		{name: "empty value", values: []string{"flag="}, want: map[string]string{"flag": ""}},
+		{name: "last wins", values: []string{"build=1", "build=2"}, want: map[string]string{"build": "2"}},
+		{name: "missing equals", values: []string{"build"}, wantErr: true},
+		{name: "missing key", values: []string{"=42"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProperties(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseProperties() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseProperties() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
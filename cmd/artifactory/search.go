@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+
+	"usi/pkg/errors"
+)
+
+var aqlFields = []string{"repo", "path", "name", "size", "created", "modified", "sha256", "actual_sha1", "actual_md5"}
+
+type Item struct {
+	Repo     string    `json:"repo"`
+	Path     string    `json:"path"`
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+	Sha256   string    `json:"sha256"`
+	Sha1     string    `json:"actual_sha1"`
+	Md5      string    `json:"actual_md5"`
+}
+
+func (i Item) FullPath() string {
+	if i.Path == "" || i.Path == "." {
+		return i.Name
+	}
+	return i.Path + "/" + i.Name
+}
+
+type SearchQuery struct {
+	Repo           string
+	Path           string
+	Name           string
+	ModifiedAfter  *time.Time
+	ModifiedBefore *time.Time
+	Properties     map[string]string
+	Limit          int
+}
+
+func CmdSearch(app *cli.Cmd) {
+	app.Spec = "[ --path=<glob> ] [ --name=<pattern> ] [ --modified-after=<time> ] [ --modified-before=<time> ] [ -p=<key=value> ]... [ --limit=<n> ] [ --json ] URL REPO"
+	baseURL := app.StringArg("URL", "", "artifactory base url (e.g. https://host/artifactory)")
+	repo := app.StringArg("REPO", "", "repository to search")
+	path := app.StringOpt("path", "", "path glob within the repository (e.g. builds/*)")
+	name := app.StringOpt("name", "", "artifact name pattern (e.g. *.tar.gz)")
+	modifiedAfter := app.StringOpt("modified-after", "", "only artifacts modified after a date, RFC3339 time or age (e.g. 2024-01-31, 36h, 7d)")
+	modifiedBefore := app.StringOpt("modified-before", "", "only artifacts modified before a date, RFC3339 time or age (e.g. 2024-01-31, 36h, 7d)")
+	props := app.StringsOpt("p prop", nil, "only artifacts with property key=value (repeatable)")
+	limit := app.IntOpt("limit", 0, "max records to return")
+	asJSON := app.BoolOpt("json", false, "print results as JSON")
+	app.Action = func() {
+		query := SearchQuery{Repo: *repo, Path: *path, Name: *name, Limit: *limit}
+		now := time.Now()
+		if *modifiedAfter != "" {
+			t, err := ParseTime(*modifiedAfter, now)
+			if err != nil {
+				HandleError(err)
+			}
+			query.ModifiedAfter = &t
+		}
+		if *modifiedBefore != "" {
+			t, err := ParseTime(*modifiedBefore, now)
+			if err != nil {
+				HandleError(err)
+			}
+			query.ModifiedBefore = &t
+		}
+		properties, err := ParseProperties(*props)
+		if err != nil {
+			HandleError(err)
+		}
+		query.Properties = properties
+
+		items, err := Search(*baseURL, query)
+		if err != nil {
+			HandleError(err)
+		}
+		if *asJSON {
+			b, err := json.MarshalIndent(items, "", "  ")
+			if err != nil {
+				HandleError(err)
+			}
+			fmt.Println(string(b))
+			return
+		}
+		PrintItems(items)
+	}
+}
+
+func (q SearchQuery) AQL() (string, error) {
+	criteria := []map[string]interface{}{
+		{"repo": q.Repo},
+		{"type": "file"},
+	}
+	if q.Path != "" {
+		criteria = append(criteria, map[string]interface{}{"path": map[string]string{"$match": q.Path}})
+	}
+	if q.Name != "" {
+		criteria = append(criteria, map[string]interface{}{"name": map[string]string{"$match": q.Name}})
+	}
+	if q.ModifiedAfter != nil {
+		criteria = append(criteria, map[string]interface{}{"modified": map[string]string{"$gt": q.ModifiedAfter.UTC().Format(time.RFC3339)}})
+	}
+	if q.ModifiedBefore != nil {
+		criteria = append(criteria, map[string]interface{}{"modified": map[string]string{"$lt": q.ModifiedBefore.UTC().Format(time.RFC3339)}})
+	}
+	for key, value := range q.Properties {
+		criteria = append(criteria, map[string]interface{}{"@" + key: map[string]string{"$match": value}})
+	}
+	find, err := json.Marshal(map[string]interface{}{"$and": criteria})
+	if err != nil {
+		return "", err
+	}
+	include, err := json.Marshal(aqlFields)
+	if err != nil {
+		return "", err
+	}
+	aql := fmt.Sprintf(`items.find(%s).include(%s).sort({"$asc":["path","name"]})`,
+		find, strings.Trim(string(include), "[]"))
+	if q.Limit > 0 {
+		aql += fmt.Sprintf(".limit(%d)", q.Limit)
+	}
+	return aql, nil
+}
+
+func Search(baseURL string, query SearchQuery) ([]Item, error) {
+	aql, err := query.AQL()
+	if err != nil {
+		return nil, err
+	}
+	req, err := NewRequest("POST", strings.TrimSuffix(baseURL, "/")+"/api/search/aql", bytes.NewBufferString(aql))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	_, body, err := Do(req)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Results []Item `json:"results"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return result.Results, nil
+}
+
+func PrintItems(items []Item) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PATH\tSIZE\tSHA256\tCREATED\tMODIFIED")
+	for _, item := range items {
+		_, _ = fmt.Fprintf(w, "%s/%s\t%d\t%s\t%s\t%s\n", item.Repo, item.FullPath(), item.Size, item.Sha256,
+			item.Created.Local().Format(time.RFC3339), item.Modified.Local().Format(time.RFC3339))
+	}
+	_ = w.Flush()
+	fmt.Printf("%d artifact(s)\n", len(items))
+}
+
+// ParseTime accepts an RFC3339 time, a date, or an age relative to now such as 36h or 7d.
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	age, err := ParseAge(value)
+	if err != nil {
+		return time.Time{}, errors.WithCode(fmt.Sprintf("invalid time %q: expected RFC3339, YYYY-MM-DD or an age like 7d", value), errors.BadRequest)
+	}
+	return now.Add(-age), nil
+}
+
+func ParseAge(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
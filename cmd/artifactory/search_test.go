@@ -0,0 +1,145 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	server := newTestServer(t)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	server.Put("libs/builds/1/app.tar.gz", []byte("1"), now.Add(-72*time.Hour), map[string]string{"branch": "main"})
+	server.Put("libs/builds/2/app.tar.gz", []byte("2"), now.Add(-24*time.Hour), map[string]string{"branch": "feature"})
+	server.Put("libs/builds/2/app.pom", []byte("pom"), now.Add(-24*time.Hour), nil)
+	server.Put("libs/docs/readme.md", []byte("docs"), now, nil)
+	server.Put("other/builds/1/app.tar.gz", []byte("other"), now, nil)
+	before := now.Add(-48 * time.Hour)
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []string
+	}{
+		{name: "repository", query: SearchQuery{Repo: "libs"},
+			want: []string{"builds/1/app.tar.gz", "builds/2/app.pom", "builds/2/app.tar.gz", "docs/readme.md"}},
+		{name: "path", query: SearchQuery{Repo: "libs", Path: "builds/*"},
+			want: []string{"builds/1/app.tar.gz", "builds/2/app.pom", "builds/2/app.tar.gz"}},
+		{name: "name", query: SearchQuery{Repo: "libs", Name: "*.tar.gz"},
+			want: []string{"builds/1/app.tar.gz", "builds/2/app.tar.gz"}},
+		{name: "property", query: SearchQuery{Repo: "libs", Properties: map[string]string{"branch": "feat*"}},
+			want: []string{"builds/2/app.tar.gz"}},
+		{name: "modified before", query: SearchQuery{Repo: "libs", ModifiedBefore: &before},
+			want: []string{"builds/1/app.tar.gz"}},
+		{name: "modified after", query: SearchQuery{Repo: "libs", Name: "*.tar.gz", ModifiedAfter: &before},
+			want: []string{"builds/2/app.tar.gz"}},
+		{name: "limit", query: SearchQuery{Repo: "libs", Limit: 2},
+			want: []string{"builds/1/app.tar.gz", "builds/2/app.pom"}},
+		{name: "no match", query: SearchQuery{Repo: "libs", Name: "*.zip"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := Search(server.BaseURL(), tt.query)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			var got []string
+			for _, item := range items {
+				if item.Repo != tt.query.Repo {
+					t.Errorf("Search() returned %s from repository %s", item.FullPath(), item.Repo)
+				}
+				got = append(got, item.FullPath())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchQueryAQL(t *testing.T) {
+	after := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	include := `.include("repo","path","name","size","created","modified","sha256","actual_sha1","actual_md5").sort({"$asc":["path","name"]})`
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  string
+	}{
+		{name: "repository", query: SearchQuery{Repo: "libs"},
+			want: `items.find({"$and":[{"repo":"libs"},{"type":"file"}]})` + include},
+		{name: "path and name", query: SearchQuery{Repo: "libs", Path: "builds/*", Name: "*.tar.gz"},
+			want: `items.find({"$and":[{"repo":"libs"},{"type":"file"},{"path":{"$match":"builds/*"}},{"name":{"$match":"*.tar.gz"}}]})` + include},
+		{name: "modified range", query: SearchQuery{Repo: "libs", ModifiedAfter: &after, ModifiedBefore: &after},
+			want: `items.find({"$and":[{"repo":"libs"},{"type":"file"},{"modified":{"$gt":"2024-01-31T00:00:00Z"}},{"modified":{"$lt":"2024-01-31T00:00:00Z"}}]})` + include},
+		{name: "property", query: SearchQuery{Repo: "libs", Properties: map[string]string{"build": "42"}},
+			want: `items.find({"$and":[{"repo":"libs"},{"type":"file"},{"@build":{"$match":"42"}}]})` + include},
+		{name: "limit", query: SearchQuery{Repo: "libs", Limit: 10},
+			want: `items.find({"$and":[{"repo":"libs"},{"type":"file"}]})` + include + `.limit(10)`},
+		{name: "quoting", query: SearchQuery{Repo: `li"bs`},
+			want: `items.find({"$and":[{"repo":"li\"bs"},{"type":"file"}]})` + include},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query.AQL()
+			if err != nil {
+				t.Fatalf("AQL() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("AQL() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "36h", want: 36 * time.Hour},
+		{value: "90m", want: 90 * time.Minute},
+		{value: "7d", want: 7 * 24 * time.Hour},
+		{value: "0d", want: 0},
+		{value: "xd", wantErr: true},
+		{value: "7", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseAge(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAge() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2024-01-31T10:00:00Z", want: time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC)},
+		{value: "2024-01-31", want: time.Date(2024, 1, 31, 0, 0, 0, 0, time.Local)},
+		{value: "36h", want: now.Add(-36 * time.Hour)},
+		{value: "7d", want: now.Add(-7 * 24 * time.Hour)},
+		{value: "last week", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTime(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseTime() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
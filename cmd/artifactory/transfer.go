@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+
+	"usi/pkg/errors"
+)
+
+type copyMessage struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+func CmdCopy(app *cli.Cmd) {
+	transferCmd(app, "copy")
+}
+
+func CmdMove(app *cli.Cmd) {
+	transferCmd(app, "move")
+}
+
+func transferCmd(app *cli.Cmd, operation string) {
+	app.Spec = "[ -r ] [ -d ] SRC DEST"
+	src := app.StringArg("SRC", "", "artifactory url of the source artifact or folder")
+	dest := app.StringArg("DEST", "", "artifactory url of the target path")
+	recursive := app.BoolOpt("r recursive", false, "allow folders and "+operation+" everything under them")
+	dryRun := app.BoolOpt("d dry-run", false, "report what would be done without changing anything")
+	app.Action = func() {
+		HandleError(Transfer(operation, *src, *dest, *recursive, *dryRun))
+	}
+}
+
+func CmdPromote(app *cli.Cmd) {
+	app.Spec = "[ -r ] [ -d ] [ --move ] [ --stamp ] [ -p=<key=value> ]... SRC DEST"
+	src := app.StringArg("SRC", "", "artifactory url of the build in the source repository (e.g. snapshot)")
+	dest := app.StringArg("DEST", "", "artifactory url to promote to (e.g. release)")
+	recursive := app.BoolOpt("r recursive", false, "allow folders and promote everything under them")
+	dryRun := app.BoolOpt("d dry-run", false, "report what would be done without changing anything")
+	move := app.BoolOpt("move", false, "move instead of copy, removing the source")
+	stamp := app.BoolOpt("stamp", false, "record promoted.by, promoted.at and promoted.from properties on the promoted artifacts")
+	props := app.StringsOpt("p prop", nil, "additional property key=value to set on the promoted artifacts (repeatable)")
+	app.Action = func() {
+		properties, err := ParseProperties(*props)
+		if err != nil {
+			HandleError(err)
+		}
+		if *stamp {
+			for key, value := range PromotionStamp(*src, time.Now()) {
+				properties[key] = value
+			}
+		}
+
+		operation := "copy"
+		if *move {
+			operation = "move"
+		}
+		HandleError(Transfer(operation, *src, *dest, *recursive, *dryRun))
+		if len(properties) == 0 {
+			return
+		}
+		if *dryRun {
+			fmt.Printf("Would set %s on %s\n", FormatProperties(properties), *dest)
+			return
+		}
+		HandleError(SetProperties(*dest, properties, *recursive))
+		fmt.Printf("Set %s on %s\n", FormatProperties(properties), *dest)
+	}
+}
+
+func PromotionStamp(src string, at time.Time) map[string]string {
+	promoter := os.Getenv("USER")
+	if promoter == "" {
+		if u, err := user.Current(); err == nil {
+			promoter = u.Username
+		}
+	}
+	return map[string]string{
+		"promoted.by":   promoter,
+		"promoted.at":   at.UTC().Format(time.RFC3339),
+		"promoted.from": src,
+	}
+}
+
+// Transfer runs artifactory's server-side copy or move from src to dest.
+func Transfer(operation, src, dest string, recursive, dryRun bool) error {
+	from, err := ArtifactPath(src)
+	if err != nil {
+		return err
+	}
+	to, err := ArtifactPath(dest)
+	if err != nil {
+		return err
+	}
+	if from.base.String() != to.base.String() {
+		return errors.WithCode(fmt.Sprintf("cannot %s between different artifactory instances (%s and %s)", operation, from.base, to.base), errors.BadRequest)
+	}
+	if !recursive {
+		folder, err := IsFolder(src)
+		if err != nil {
+			return err
+		}
+		if folder {
+			return errors.WithCode(fmt.Sprintf("%s is a folder, pass -r to %s it recursively", src, operation), errors.BadRequest)
+		}
+	}
+
+	u := *from.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/" + operation + "/" + from.repoPath
+	query := url.Values{}
+	query.Set("to", "/"+to.repoPath)
+	if dryRun {
+		query.Set("dry", "1")
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	_, body, err := Do(req)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Messages []copyMessage `json:"messages"`
+	}
+	if json.Unmarshal(body, &result) == nil {
+		for _, message := range result.Messages {
+			fmt.Printf("%s: %s\n", message.Level, message.Message)
+		}
+	}
+	if dryRun {
+		fmt.Printf("Dry run: would %s %s to %s\n", operation, src, dest)
+	} else {
+		fmt.Printf("Finished %s of %s to %s\n", operation, src, dest)
+	}
+	return nil
+}
+
+func IsFolder(artifactURL string) (bool, error) {
+	u, err := StorageURL(artifactURL)
+	if err != nil {
+		return false, err
+	}
+	req, err := NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	_, body, err := Do(req)
+	if err != nil {
+		return false, err
+	}
+	var info struct {
+		Children *[]interface{} `json:"children"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return false, err
+	}
+	return info.Children != nil, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"usi/pkg/errors"
+)
+
+func TestTransfer(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation string
+		src       string
+		dest      string
+		recursive bool
+		dryRun    bool
+		want      []string
+		code      errors.Code
+	}{
+		{name: "copy file", operation: "copy", src: "snapshot/app/1.0/app.tar.gz", dest: "release/app/1.0/app.tar.gz",
+			want: []string{"release/app/1.0/app.tar.gz", "snapshot/app/1.0/app.pom", "snapshot/app/1.0/app.tar.gz"}},
+		{name: "copy folder", operation: "copy", src: "snapshot/app/1.0", dest: "release/app/1.0", recursive: true,
+			want: []string{"release/app/1.0/app.pom", "release/app/1.0/app.tar.gz", "snapshot/app/1.0/app.pom", "snapshot/app/1.0/app.tar.gz"}},
+		{name: "move folder", operation: "move", src: "snapshot/app/1.0", dest: "release/app/1.0", recursive: true,
+			want: []string{"release/app/1.0/app.pom", "release/app/1.0/app.tar.gz"}},
+		{name: "dry run", operation: "move", src: "snapshot/app/1.0", dest: "release/app/1.0", recursive: true, dryRun: true,
+			want: []string{"snapshot/app/1.0/app.pom", "snapshot/app/1.0/app.tar.gz"}},
+		{name: "folder without recursive", operation: "copy", src: "snapshot/app/1.0", dest: "release/app/1.0", code: errors.BadRequest},
+		{name: "missing source", operation: "copy", src: "snapshot/app/2.0/app.tar.gz", dest: "release/app/2.0/app.tar.gz", code: errors.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			server.Put("snapshot/app/1.0/app.tar.gz", []byte("app"), time.Now(), map[string]string{"build": "42"})
+			server.Put("snapshot/app/1.0/app.pom", []byte("pom"), time.Now(), nil)
+
+			err := Transfer(tt.operation, server.ArtifactURL(tt.src), server.ArtifactURL(tt.dest), tt.recursive, tt.dryRun)
+			if tt.code != errors.Unexpected {
+				if errorCode(err) != tt.code {
+					t.Fatalf("Transfer() error = %v, want code %v", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Transfer() error = %v", err)
+			}
+			var got []string
+			for _, item := range server.Items() {
+				got = append(got, item.RepoPath())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("after %s items = %v, want %v", tt.operation, got, tt.want)
+			}
+			if copied := server.Item("release/app/1.0/app.tar.gz"); copied != nil && !reflect.DeepEqual(copied.Properties["build"], []string{"42"}) {
+				t.Errorf("%s lost the properties of the source: %v", tt.operation, copied.Properties)
+			}
+		})
+	}
+}
+
+func TestTransferBetweenInstances(t *testing.T) {
+	err := Transfer("copy", "https://a.example.com/artifactory/libs/app.tar.gz", "https://b.example.com/artifactory/libs/app.tar.gz", false, false)
+	if errorCode(err) != errors.BadRequest {
+		t.Fatalf("Transfer() error = %v, want a bad request", err)
+	}
+}
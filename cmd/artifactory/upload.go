@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+
+	"usi/pkg/errors"
+)
+
+type UploadOptions struct {
+	ChecksumDeploy bool
+	// PartSize, when set, uploads larger files in resumable parts of this many bytes.
+	PartSize   int64
+	Properties map[string]string
+}
+
+type UploadResult struct {
+	Target
+	Size       int64
+	ByChecksum bool
+	Response   *http.Response
+	Body       []byte
+}
+
+func CmdUpload(app *cli.Cmd) {
+	path := app.StringArg("PATH", "", "artifact file path, directory or glob")
+	url := app.StringArg("URL", "", "artifactory url (the target folder when PATH is a directory or glob)")
+	checksumDeploy := app.BoolOpt("checksum-deploy", true, "try deploying by checksum first so content already on artifactory isn't re-sent")
+	partSize := app.IntOpt("part-size", 100, "upload files larger than this many MiB in parts that a rerun resumes (0 uploads in a single request)")
+	jobs := app.IntOpt("j jobs", 4, "number of files to upload in parallel")
+	dryRun := app.BoolOpt("d dry-run", false, "list the target urls without uploading anything")
+	props := app.StringsOpt("p prop", nil, "property key=value to attach to the uploaded artifacts (repeatable)")
+	app.Action = func() {
+		properties, err := ParseProperties(*props)
+		if err != nil {
+			HandleError(err)
+		}
+		targets, single, err := CollectTargets(*path, *url)
+		if err != nil {
+			HandleError(err)
+		}
+		if *dryRun {
+			for _, target := range targets {
+				fmt.Printf("%s -> %s%s\n", target.Path, target.URL, MatrixParams(properties))
+			}
+			fmt.Printf("%d file(s) would be uploaded\n", len(targets))
+			return
+		}
+
+		opts := UploadOptions{ChecksumDeploy: *checksumDeploy, PartSize: int64(*partSize) * bytesPerMiB, Properties: properties}
+		if single {
+			result, err := UploadFile(targets[0], opts)
+			if err != nil {
+				HandleError(err)
+			}
+			PrintResponse(result.Response, result.Body)
+			return
+		}
+		HandleError(UploadAll(targets, opts, *jobs))
+	}
+}
+
+func UploadAll(targets []Target, opts UploadOptions, jobs int) error {
+	start := time.Now()
+	progress := NewProgress(len(targets))
+	results := RunParallel(targets, jobs, func(target Target) (UploadResult, error) {
+		result, err := UploadFile(target, opts)
+		progress.Add(result.Size, err == nil)
+		return result, err
+	})
+	progress.Done()
+
+	var uploaded, byChecksum, failed int
+	var bytes int64
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Printf("FAILED %s -> %s: %s\n", result.Value.Path, result.Value.URL, result.Err.Error())
+		case result.Value.ByChecksum:
+			byChecksum++
+		default:
+			uploaded++
+			bytes += result.Value.Size
+		}
+	}
+	fmt.Printf("Uploaded %d file(s) (%s), deployed %d by checksum, %d failed in %s\n",
+		uploaded, FormatBytes(bytes), byChecksum, failed, time.Since(start).Round(time.Millisecond))
+	if failed > 0 {
+		return errors.WithCode(fmt.Sprintf("%d of %d uploads failed", failed, len(targets)), errors.BadRequest)
+	}
+	return nil
+}
+
+func UploadFile(target Target, opts UploadOptions) (UploadResult, error) {
+	result := UploadResult{Target: target}
+	checksums, size, err := FileChecksums(target.Path)
+	if err != nil {
+		return result, err
+	}
+	result.Size = size
+	deployURL := target.URL + MatrixParams(opts.Properties)
+
+	if opts.ChecksumDeploy {
+		res, body, err := DeployByChecksum(deployURL, checksums)
+		if err != nil {
+			return result, err
+		}
+		if res != nil {
+			result.ByChecksum, result.Response, result.Body = true, res, body
+			return result, nil
+		}
+	}
+
+	if opts.PartSize > 0 && size > opts.PartSize {
+		result.Response, result.Body, err = UploadMultipart(target.Path, target.URL, checksums, size, opts.PartSize)
+		if err != errMultipartUnsupported {
+			if err == nil && len(opts.Properties) > 0 {
+				err = SetProperties(target.URL, opts.Properties, false)
+			}
+			return result, err
+		}
+		fmt.Printf("%s: %s, uploading %s in a single request\n", target.URL, err.Error(), target.Path)
+	}
+	result.Response, result.Body, err = Upload(target.Path, deployURL, checksums, size)
+	return result, err
+}
+
+// DeployByChecksum asks artifactory to deploy the artifact from content it already
+// stores. It returns a nil response when artifactory doesn't know the checksum and
+// the content has to be uploaded.
+func DeployByChecksum(url string, checksums *Checksums) (*http.Response, []byte, error) {
+	req, err := NewRequest("PUT", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set(HeaderChecksumDeploy, "true")
+	checksums.SetHeaders(req.Header)
+	res, body, err := Do(req)
+	if res != nil && res.StatusCode == http.StatusNotFound {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, body, nil
+}
+
+func Upload(path, url string, checksums *Checksums, size int64) (*http.Response, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	req, err := NewRequest("PUT", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	setFileBody(req, f, 0, size)
+	checksums.SetHeaders(req.Header)
+	return Do(req)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"usi/cmd/artifactory/artifactorytest"
+	"usi/pkg/errors"
+)
+
+func writeFile(t *testing.T, path, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// bodyPuts counts the PUTs that sent content rather than deploying by checksum.
+func bodyPuts(requests []artifactorytest.Request) int {
+	puts := 0
+	for _, r := range requests {
+		if r.Method == http.MethodPut && r.Header.Get(HeaderChecksumDeploy) != "true" {
+			puts++
+		}
+	}
+	return puts
+}
+
+func TestUploadFile(t *testing.T) {
+	server := newTestServer(t)
+	server.Put("libs/existing/app.tar.gz", []byte("known content"), time.Now(), nil)
+	dir := t.TempDir()
+	known := writeFile(t, filepath.Join(dir, "known.tar.gz"), "known content")
+	fresh := writeFile(t, filepath.Join(dir, "fresh.tar.gz"), "fresh content")
+
+	tests := []struct {
+		name       string
+		path       string
+		repoPath   string
+		opts       UploadOptions
+		byChecksum bool
+		bodyPuts   int
+	}{
+		{name: "checksum deploy hit", path: known, repoPath: "libs/copy/app.tar.gz", opts: UploadOptions{ChecksumDeploy: true}, byChecksum: true},
+		{name: "checksum deploy miss", path: fresh, repoPath: "libs/fresh/app.tar.gz", opts: UploadOptions{ChecksumDeploy: true}, bodyPuts: 1},
+		{name: "without checksum deploy", path: known, repoPath: "libs/plain/app.tar.gz", bodyPuts: 1},
+		{name: "with properties", path: fresh, repoPath: "libs/props/app.tar.gz",
+			opts: UploadOptions{Properties: map[string]string{"build": "42", "branch": "feature/a b"}}, bodyPuts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(server.Requests())
+			result, err := UploadFile(Target{Path: tt.path, URL: server.ArtifactURL(tt.repoPath)}, tt.opts)
+			if err != nil {
+				t.Fatalf("UploadFile() error = %v", err)
+			}
+			if result.ByChecksum != tt.byChecksum {
+				t.Errorf("UploadFile() ByChecksum = %v, want %v", result.ByChecksum, tt.byChecksum)
+			}
+			if puts := bodyPuts(server.Requests()[before:]); puts != tt.bodyPuts {
+				t.Errorf("UploadFile() sent %d content PUTs, want %d", puts, tt.bodyPuts)
+			}
+			want, _ := os.ReadFile(tt.path)
+			if got, _ := server.Content(tt.repoPath); !bytes.Equal(got, want) {
+				t.Errorf("stored content = %q, want %q", got, want)
+			}
+			item := server.Item(tt.repoPath)
+			for key, value := range tt.opts.Properties {
+				if !reflect.DeepEqual(item.Properties[key], []string{value}) {
+					t.Errorf("property %s = %v, want %s", key, item.Properties[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadRejectsChecksumMismatch(t *testing.T) {
+	server := newTestServer(t)
+	path := writeFile(t, filepath.Join(t.TempDir(), "app.tar.gz"), "content")
+	checksums, size, err := FileChecksums(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksums.Sha256 = "0000000000000000000000000000000000000000000000000000000000000000"
+
+	_, _, err = Upload(path, server.ArtifactURL("libs/app.tar.gz"), checksums, size)
+	if errorCode(err) != errors.Conflict {
+		t.Fatalf("Upload() error = %v, want a conflict", err)
+	}
+	if server.Item("libs/app.tar.gz") != nil {
+		t.Error("the rejected artifact was stored")
+	}
+}
+
+func TestUploadRetriesTransientFailures(t *testing.T) {
+	server := newTestServer(t)
+	server.InjectFault(artifactorytest.Fault{Method: http.MethodPut, PathPrefix: "/artifactory/libs/", Status: http.StatusServiceUnavailable, Count: 1})
+	path := writeFile(t, filepath.Join(t.TempDir(), "app.tar.gz"), "retried content")
+
+	if _, err := UploadFile(Target{Path: path, URL: server.ArtifactURL("libs/app.tar.gz")}, UploadOptions{}); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	if got, _ := server.Content("libs/app.tar.gz"); string(got) != "retried content" {
+		t.Errorf("stored content = %q, want the full body after the retry", got)
+	}
+	if puts := bodyPuts(server.Requests()); puts != 2 {
+		t.Errorf("sent %d PUTs, want 2", puts)
+	}
+}
+
+func TestUploadAll(t *testing.T) {
+	server := newTestServer(t)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeFile(t, filepath.Join(dir, "nested", "b.txt"), "b")
+	writeFile(t, filepath.Join(dir, "nested", "c d.txt"), "c")
+
+	targets, single, err := CollectTargets(dir, server.ArtifactURL("libs/build"))
+	if err != nil || single {
+		t.Fatalf("CollectTargets() = %v, %v, %v", targets, single, err)
+	}
+	if err := UploadAll(targets, UploadOptions{ChecksumDeploy: true}, 2); err != nil {
+		t.Fatalf("UploadAll() error = %v", err)
+	}
+	for repoPath, want := range map[string]string{"libs/build/a.txt": "a", "libs/build/nested/b.txt": "b", "libs/build/nested/c d.txt": "c"} {
+		if got, ok := server.Content(repoPath); !ok || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", repoPath, got, ok, want)
+		}
+	}
+}
@@ -12,11 +12,12 @@ import (
 
 func CmdBounce(cmd *cli.Cmd) {
 	command := "bounce"
-	cmd.Spec = "[-n=<service name>] [ -s=<selector> ] [ -e=<environment> ] [-r]"
+	cmd.Spec = "[-n=<service name>] [ -s=<selector> ] [ -e=<environment> ] [-r] [ --timeout=<duration> ]"
 	opts := NewOpts(cmd)
 	opts.NameOpt()
 	opts.EnvironmentOpt()
 	opts.SelectorOpt()
+	timeout := opts.TimeoutOpt()
 	resolveBool := cmd.BoolOpt("r resolve", false, "preform a configuration resolution prior to bounce")
 	cmd.Action = func() {
 		opts.Normalize(command)
@@ -32,7 +33,19 @@ func CmdBounce(cmd *cli.Cmd) {
 
 		deploymentRequest := core.RequestFromTypeAndNameAndSelector(
 			deployment.TypeName, *deployment.Name(*environmentName, serviceName, mergedServiceSelectors), nil)
-		_, err = Workspace(nil, os.Stdout, os.Stderr, command).Bounce(Requester(), deploymentRequest, *resolveBool)
+		op := StartOperation(command, timeout, nil)
+		op.Telemetry(map[string]interface{}{
+			"environment":  *environmentName,
+			"service_name": serviceName,
+		})
+		op.Phase("bounce")
+		_, err = Await(op, func(resolve bool) (struct{}, error) {
+			_, err := Workspace(nil, os.Stdout, os.Stderr, command).Bounce(Requester(), deploymentRequest, resolve)
+			return struct{}{}, err
+		}, *resolveBool)
+		op.Check(err)
+		HandleError(err, command)
+		op.Done()
 
 		if !*resolveBool {
 			PrintHeader("%s deployment was successfully bounced.", serviceName)
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"platform-go-common/pkg/errors"
+
+	"usi/pkg/core"
+	"usi/pkg/registry"
+	"usi/pkg/type/deployment"
+)
+
+// CanarySelector returns a fresh selector for a canary copy of a service, e.g. canary3f9a0c7e.
+// The suffix is random so canaries started at the same time don't share a selector.
+func CanarySelector() string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		// crypto/rand doesn't fail on supported platforms, the clock still separates most runs
+		return "canary" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return "canary" + hex.EncodeToString(suffix)
+}
+
+// DeployCanary deploys the workspace under a generated canary selector, waits for it and runs the
+// verification script. When the canary is healthy the primary is redeployed from the canary's
+// declaration and configuration, so it gets exactly the artifact that was verified. Either way the
+// canary is undeployed afterwards, also when op is cancelled.
+func DeployCanary(op *Operation, command string, deployOpts DeployOpts, verify string) {
+	start := time.Now()
+	canarySelector := CanarySelector()
+	selectors := canarySelector
+	if *deployOpts.selector != "" {
+		selectors = *deployOpts.selector + "," + canarySelector
+	}
+	serviceName, serviceSelector := core.ParseSelectorNameAndAddCliSelector(*deployOpts.name, selectors) // already normalizes
+	canaryName := *core.JoinNameAndSelector(serviceName, serviceSelector)
+
+	canaryOpts := deployOpts
+	canaryOpts.selector = &selectors
+	noWait, noLogs := false, false
+	canaryOpts.wait, canaryOpts.logs = &noWait, &noLogs
+
+	executable, err := os.Executable()
+	HandleError(err, command)
+	var outMu sync.Mutex
+
+	PrintHeader("* Deploying canary %s", canaryName)
+	op.Phase("canary deploy")
+	if err := runStackDeploy(op.Context(), executable, canaryOpts, StackService{Name: *deployOpts.name}, &outMu); err != nil {
+		op.Check(op.Err())
+		reportCanary(command, deployOpts, canarySelector, "canary_failed", start)
+		HandleError(errors.WithCode(fmt.Sprintf("canary deploy failed: %s", err.Error()), errors.BadRequest), command)
+	}
+
+	canaryRequest := core.RequestFromTypeAndNameAndSelector(deployment.TypeName,
+		*deployment.Name(*deployOpts.env, serviceName, serviceSelector), nil)
+	// the canary is removed once, whether the command ends normally or is cancelled
+	var removeOnce sync.Once
+	removeCanary := func() {
+		removeOnce.Do(func() { undeployCanary(command, canaryRequest, canaryName) })
+	}
+	op.OnAbort(removeCanary)
+	op.Phase("canary verify")
+	failure, err := verifyCanary(op.Context(), command, executable, deployOpts, selectors, verify, &outMu)
+	op.Check(op.Err())
+	if err != nil {
+		removeCanary()
+		reportCanary(command, deployOpts, canarySelector, "canary_error", start)
+		HandleError(fmt.Errorf("unable to verify canary %s: %s", canaryName, err.Error()), command)
+	}
+	if failure != "" {
+		PrintWarning(fmt.Sprintf("Canary %s failed: %s", canaryName, failure))
+		removeCanary()
+		reportCanary(command, deployOpts, canarySelector, "rolled_back", start)
+		HandleError(errors.WithCode(fmt.Sprintf("canary %s failed: %s", canaryName, failure), errors.BadRequest), command)
+	}
+
+	canary := GetServiceDeployment(command, *deployOpts.env, *deployOpts.name, StrToSelector(&selectors, command))
+	if canary == nil {
+		HandleError(errors.WithCode(errors.InvalidServiceDeploymentErrorMessage, errors.NotFound), command)
+	}
+	PrintHeader("* Promoting canary %s", canaryName)
+	op.Phase("promote")
+	request := DeployRequestFromResource(canary, *deployOpts.env, command)
+	request.Declaration.OptionalSelector = nil
+	if *deployOpts.selector != "" {
+		request.Declaration.OptionalSelector = deployOpts.selector
+	}
+	if deployOpts.force != nil {
+		request.Force = *deployOpts.force
+	}
+	lock := AcquireDeployLock(command, *deployOpts.env, *deployOpts.name, *deployOpts.selector,
+		ParseLockTTL(deployOpts.lockTTL, command), request.Force)
+	op.OnAbort(lock.Release)
+	deployResponse, err := Await(op, Workspace(nil, os.Stdout, os.Stderr, command).Deploy, request)
+	op.Check(err)
+	if err != nil {
+		removeCanary()
+		reportCanary(command, deployOpts, canarySelector, "promote_failed", start)
+	}
+	lock.CheckResolve(command, err)
+	lock.Release()
+	PrintHeader("Completed Deployment: %s (%s) in %vs", deployResponse.Deployment.Name, deployResponse.Deployment.UUID, roundFloat(time.Since(start).Seconds(), 3))
+	if deployResponse.Warnings != nil {
+		for _, warning := range deployResponse.Warnings {
+			PrintWarning(warning)
+		}
+	}
+	HandleDeployWarning(deployResponse, command)
+	removeCanary()
+
+	if deployOpts.wait != nil && *deployOpts.wait {
+		op.Phase("wait")
+		WaitForDeploymentContext(op.Context(), deployResponse.Deployment, *deployOpts.env, command)
+		if *deployOpts.httpReady {
+			op.Phase("http ready")
+			WaitForDeploymentReady(op.Context(), deployResponse.Deployment, command)
+		}
+		op.Check(op.Err())
+	}
+	op.Done()
+	reportCanary(command, deployOpts, canarySelector, "success", start)
+}
+
+// verifyCanary waits for the canary and runs the verification script against it. It returns why
+// the canary is unhealthy, or an empty string, and an error when the canary couldn't be checked.
+func verifyCanary(ctx context.Context, command, executable string, deployOpts DeployOpts, selectors, verify string, outMu *sync.Mutex) (string, error) {
+	canary := GetServiceDeployment(command, *deployOpts.env, *deployOpts.name, StrToSelector(&selectors, command))
+	if canary == nil {
+		return "canary deployment not found after deploying", nil
+	}
+
+	if IsDevEnvironmentDeployment(canary, command) {
+		PrintHeader("* Waiting for canary")
+		args := []string{"wait", "-n=" + *deployOpts.name, "-s=" + selectors, "-e=" + *deployOpts.env}
+		if deployOpts.httpReady != nil && *deployOpts.httpReady {
+			args = append(args, "--http-ready")
+		}
+		wait := exec.Command(executable, args...)
+		out := &prefixWriter{mu: outMu, w: os.Stdout, prefix: "[wait] "}
+		errOut := &prefixWriter{mu: outMu, w: os.Stderr, prefix: "[wait] "}
+		wait.Stdout, wait.Stderr = out, errOut
+		err := RunChild(ctx, wait)
+		out.Flush()
+		errOut.Flush()
+		if err != nil {
+			if !canaryUnhealthy(err) {
+				return "", fmt.Errorf("usi wait: %s", err.Error())
+			}
+			return "did not become ready: " + err.Error(), nil
+		}
+	} else {
+		PrintWarning("Readiness can only be checked for user namespace deploys, relying on the verification script")
+	}
+
+	if verify == "" {
+		return "", nil
+	}
+	links, err := json.Marshal(canary.Links)
+	if err != nil {
+		return "", err
+	}
+	PrintHeader("* Verifying canary: %s", verify)
+	script := exec.Command("sh", "-c", verify)
+	script.Env = append(os.Environ(),
+		"USI_CANARY_NAME="+canary.Name,
+		"USI_CANARY_UUID="+fmt.Sprint(canary.UUID),
+		"USI_CANARY_SELECTOR="+selectors,
+		"USI_CANARY_ENVIRONMENT="+*deployOpts.env,
+		"USI_CANARY_LINKS="+string(links),
+	)
+	out := &prefixWriter{mu: outMu, w: os.Stdout, prefix: "[verify] "}
+	errOut := &prefixWriter{mu: outMu, w: os.Stderr, prefix: "[verify] "}
+	script.Stdout, script.Stderr = out, errOut
+	err = RunChild(ctx, script)
+	out.Flush()
+	errOut.Flush()
+	if _, ok := err.(*exec.ExitError); ok {
+		return "verification script failed: " + err.Error(), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("verification script: %s", err.Error())
+	}
+	return "", nil
+}
+
+// canaryUnhealthy tells whether `usi wait` failed because the canary's rollout failed or its
+// endpoints stayed unhealthy, rather than because wait itself couldn't run or follow the rollout,
+// e.g. it exited with ExitCodeCannotWait.
+func canaryUnhealthy(err error) bool {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+	code := exitErr.ExitCode()
+	return code == ExitCodeRolloutFailed || code == ExitCodeUnhealthy
+}
+
+func undeployCanary(command string, request core.Request, canaryName string) {
+	PrintHeader("* Removing canary %s", canaryName)
+	_, err := Workspace(nil, os.Stdout, os.Stderr, command).Undeploy(registry.UndeployRequest{Deployment: request, Requester: Requester()})
+	if err != nil {
+		PrintWarning(fmt.Sprintf("Unable to undeploy canary %s, remove it with `usi undeploy`: %s", canaryName, err.Error()))
+	}
+}
+
+func reportCanary(command string, deployOpts DeployOpts, canarySelector, result string, start time.Time) {
+	Reporter.SendHoneycombEvent(command, map[string]interface{}{
+		"environment":           deployOpts.env,
+		"name":                  deployOpts.name,
+		"selectors":             deployOpts.selector,
+		"target":                deployOpts.target,
+		"canary":                canarySelector,
+		"deployment_duration_s": time.Since(start).Seconds(),
+		"result":                result,
+	})
+	Reporter.SendSnowflakeEvent(command, map[string]interface{}{
+		"service_name": *deployOpts.name,
+		"additional_info": "environment:" + *deployOpts.env + " selectors:" + *deployOpts.selector +
+			" canary:" + canarySelector + " result:" + result,
+		"environment": *deployOpts.env,
+	})
+}
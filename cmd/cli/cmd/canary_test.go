@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestCanaryUnhealthy(t *testing.T) {
+	tests := []struct {
+		name string
+		err  func() error
+		want bool
+	}{
+		{name: "rollout failed", err: exitWith(ExitCodeRolloutFailed), want: true},
+		{name: "unhealthy endpoints", err: exitWith(ExitCodeUnhealthy), want: true},
+		{name: "wait error", err: exitWith(1)},
+		{name: "cluster rejected the credentials", err: exitWith(ExitCodeCannotWait)},
+		{name: "wait timed out", err: exitWith(ExitCodeTimeout)},
+		{name: "wait not started", err: func() error { return exec.Command("/nonexistent/usi").Run() }},
+		{name: "other error", err: func() error { return errors.New("boom") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canaryUnhealthy(tt.err()); got != tt.want {
+				t.Errorf("canaryUnhealthy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func exitWith(code int) func() error {
+	return func() error {
+		return exec.Command("sh", "-c", "exit "+strconv.Itoa(code)).Run()
+	}
+}
+
+func TestCanarySelector(t *testing.T) {
+	format := regexp.MustCompile(`^canary[0-9a-f]{8}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		selector := CanarySelector()
+		if !format.MatchString(selector) {
+			t.Fatalf("CanarySelector() = %q, want canary followed by 8 hex digits", selector)
+		}
+		if seen[selector] {
+			t.Fatalf("CanarySelector() returned %q twice", selector)
+		}
+		seen[selector] = true
+	}
+}
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"platform-go-common/pkg/errors"
+)
+
+const (
+	// ExitCodeTimeout matches timeout(1) so scripts can tell a timeout apart from a failure.
+	ExitCodeTimeout     = 124
+	ExitCodeInterrupted = 130
+)
+
+type phase struct {
+	name     string
+	duration time.Duration
+}
+
+// OperationError is returned once an operation timed out or was interrupted. ExitCode is
+// ExitCodeTimeout or ExitCodeInterrupted.
+type OperationError struct {
+	Reason   string
+	ExitCode int
+}
+
+func (e *OperationError) Error() string {
+	return e.Reason
+}
+
+// Operation tracks the phases of a long running command. When its timeout passes or usi receives
+// SIGINT/SIGTERM, the context is cancelled and children started through RunChild are stopped. The
+// command itself notices through Err, Await or Done and calls Check, which prints which phases
+// completed and which was aborted, reports the command as cancelled and exits with 124 or 130.
+type Operation struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	command     string
+	timeout     time.Duration
+	events      *EventStream
+	stopped     chan struct{}
+	signals     chan os.Signal
+	mu          sync.Mutex
+	completed   []phase
+	current     string
+	started     time.Time
+	interrupted string
+	telemetry   map[string]interface{}
+	onAbort     []func()
+}
+
+// ParseTimeout reads a --timeout value; empty means no timeout.
+func ParseTimeout(timeout *string, command string) time.Duration {
+	if timeout == nil || *timeout == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(*timeout)
+	if err != nil || d <= 0 {
+		HandleError(errors.WithCode(fmt.Sprintf("invalid timeout (%s), use a duration such as 15m", *timeout), errors.BadRequest), command)
+	}
+	return d
+}
+
+// StartOperation starts watching for the timeout and for SIGINT/SIGTERM. Events may be nil.
+func StartOperation(command string, timeout *string, events *EventStream) *Operation {
+	o := &Operation{
+		command: command,
+		timeout: ParseTimeout(timeout, command),
+		events:  events,
+		stopped: make(chan struct{}),
+		signals: make(chan os.Signal, 1),
+	}
+	if o.timeout > 0 {
+		o.ctx, o.cancel = context.WithTimeout(context.Background(), o.timeout)
+	} else {
+		o.ctx, o.cancel = context.WithCancel(context.Background())
+	}
+	signal.Notify(o.signals, os.Interrupt, syscall.SIGTERM)
+	go o.watch()
+	return o
+}
+
+func (o *Operation) Context() context.Context {
+	return o.ctx
+}
+
+// Err returns an *OperationError once the operation timed out or was interrupted, and nil otherwise.
+func (o *Operation) Err() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.interrupted != "" {
+		return &OperationError{Reason: "interrupted (" + o.interrupted + ")", ExitCode: ExitCodeInterrupted}
+	}
+	if o.ctx.Err() == context.DeadlineExceeded {
+		return &OperationError{Reason: fmt.Sprintf("timed out after %v", o.timeout), ExitCode: ExitCodeTimeout}
+	}
+	return nil
+}
+
+// Await calls fn(request), e.g. a registry call that doesn't take a context, and returns its result,
+// or Err as soon as the operation is cancelled. A call that is still running then keeps running in
+// the background until usi exits.
+func Await[Request, Response any](o *Operation, fn func(Request) (Response, error), request Request) (Response, error) {
+	type result struct {
+		response Response
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		response, err := fn(request)
+		done <- result{response, err}
+	}()
+	var none Response
+	select {
+	case r := <-done:
+		if err := o.Err(); err != nil {
+			return none, err
+		}
+		return r.response, r.err
+	case <-o.ctx.Done():
+		return none, o.Err()
+	}
+}
+
+// Phase completes the current phase, if any, and starts the next one.
+func (o *Operation) Phase(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.completeLocked()
+	o.current = name
+	o.started = time.Now()
+}
+
+// Telemetry sets the fields reported when the operation is cancelled.
+func (o *Operation) Telemetry(fields map[string]interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.telemetry = fields
+}
+
+// OnAbort registers cleanup to run before usi exits on cancellation, e.g. releasing a lock.
+func (o *Operation) OnAbort(fn func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.onAbort = append(o.onAbort, fn)
+}
+
+// Done completes the last phase and stops watching for cancellation. An operation that was
+// cancelled in the meantime ends here through Check instead, so nothing after Done, such as a
+// receipt or success telemetry, happens past the deadline.
+func (o *Operation) Done() {
+	o.Check(o.Err())
+	o.mu.Lock()
+	o.completeLocked()
+	o.mu.Unlock()
+	signal.Stop(o.signals)
+	close(o.stopped)
+	o.cancel()
+}
+
+func (o *Operation) completeLocked() {
+	if o.current != "" {
+		o.completed = append(o.completed, phase{o.current, time.Since(o.started)})
+		o.current = ""
+	}
+}
+
+// watch only records the cancellation and cancels the context, which stops the children started
+// through RunChild so the command gets control back; exiting is left to Check on the command's own
+// goroutine.
+func (o *Operation) watch() {
+	select {
+	case <-o.stopped:
+		return
+	case sig := <-o.signals:
+		o.mu.Lock()
+		o.interrupted = sig.String()
+		o.mu.Unlock()
+		// a second Ctrl-C ends usi right away
+		signal.Stop(o.signals)
+		o.cancel()
+	case <-o.ctx.Done():
+	}
+}
+
+// RunChild runs cmd like cmd.Run, in a process group of its own. When ctx is done the group is
+// asked to terminate, so a cancelled operation stops cmd and everything cmd started while usi
+// itself keeps running to report the cancellation.
+func RunChild(ctx context.Context, cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stopProcessGroup(cmd)
+		case <-done:
+		}
+	}()
+	return cmd.Wait()
+}
+
+// Check exits when err is the operation's *OperationError: it prints which phases completed and
+// which was aborted, runs the OnAbort cleanup, reports the command as cancelled and exits with the
+// error's code. Any other error, including nil, is left to the caller.
+func (o *Operation) Check(err error) {
+	opErr, ok := err.(*OperationError)
+	if !ok {
+		return
+	}
+	o.mu.Lock()
+	current, completed := o.current, o.completed
+	telemetry, onAbort := o.telemetry, o.onAbort
+	o.mu.Unlock()
+
+	fmt.Println("")
+	PrintWarning(fmt.Sprintf("usi %s %s", o.command, opErr.Reason))
+	for _, p := range completed {
+		fmt.Printf("  completed: %s (%vs)\n", p.name, roundFloat(p.duration.Seconds(), 3))
+	}
+	if current != "" {
+		fmt.Printf("  aborted:   %s\n", current)
+	}
+	for _, fn := range onAbort {
+		fn()
+	}
+
+	o.events.Emit("result", current, opErr.Reason, map[string]interface{}{"result": "cancelled"})
+	fields := map[string]interface{}{}
+	for k, v := range telemetry {
+		fields[k] = v
+	}
+	fields["result"] = "cancelled"
+	fields["cancelled_phase"] = current
+	fields["cancel_reason"] = opErr.Reason
+	Reporter.SendHoneycombEvent(o.command, fields)
+	Reporter.Close()
+	os.Exit(opErr.ExitCode)
+}
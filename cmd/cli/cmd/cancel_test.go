@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"errors"
+	"os/signal"
+	"testing"
+	"time"
+)
+
+func testOperation(t *testing.T, timeout string) *Operation {
+	t.Helper()
+	op := StartOperation("deploy", &timeout, nil)
+	t.Cleanup(func() {
+		signal.Stop(op.signals)
+		op.cancel()
+	})
+	return op
+}
+
+func TestOperationErr(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeout     string
+		interrupted string
+		wait        time.Duration
+		wantCode    int
+	}{
+		{name: "running", timeout: "1h"},
+		{name: "no timeout", timeout: ""},
+		{name: "timed out", timeout: "10ms", wait: 50 * time.Millisecond, wantCode: ExitCodeTimeout},
+		{name: "interrupted", timeout: "1h", interrupted: "interrupt", wantCode: ExitCodeInterrupted},
+		{name: "interrupted wins over the timeout", timeout: "10ms", interrupted: "terminated", wait: 50 * time.Millisecond,
+			wantCode: ExitCodeInterrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := testOperation(t, tt.timeout)
+			op.mu.Lock()
+			op.interrupted = tt.interrupted
+			op.mu.Unlock()
+			time.Sleep(tt.wait)
+			err := op.Err()
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("Err() = %v, want nil", err)
+				}
+				return
+			}
+			opErr, ok := err.(*OperationError)
+			if !ok || opErr.ExitCode != tt.wantCode {
+				t.Fatalf("Err() = %#v, want exit code %d", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestAwait(t *testing.T) {
+	failed := errors.New("registry unavailable")
+	tests := []struct {
+		name     string
+		timeout  string
+		delay    time.Duration
+		err      error
+		want     string
+		wantErr  error
+		wantCode int
+	}{
+		{name: "completes", timeout: "1h", want: "deployed"},
+		{name: "fails", timeout: "1h", err: failed, wantErr: failed},
+		{name: "times out first", timeout: "20ms", delay: time.Second, wantCode: ExitCodeTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := testOperation(t, tt.timeout)
+			got, err := Await(op, func(name string) (string, error) {
+				time.Sleep(tt.delay)
+				if tt.err != nil {
+					return "", tt.err
+				}
+				return name, nil
+			}, "deployed")
+			if tt.wantCode != 0 {
+				if opErr, ok := err.(*OperationError); !ok || opErr.ExitCode != tt.wantCode {
+					t.Fatalf("Await() error = %#v, want exit code %d", err, tt.wantCode)
+				}
+				return
+			}
+			if err != tt.wantErr || got != tt.want {
+				t.Errorf("Await() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunChildStopsItsProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the shell reports the pid of a grandchild that would outlive it if only the shell was stopped
+	cmd := exec.Command("sh", "-c", "sleep 30 & echo $!; wait")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- RunChild(ctx, cmd)
+	}()
+	line, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	grandchild, err := strconv.Atoi(line[:len(line)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("RunChild() succeeded, want the child stopped")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunChild() didn't return after the context was cancelled")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for syscall.Kill(grandchild, 0) == nil {
+		if time.Now().After(deadline) {
+			_ = syscall.Kill(grandchild, syscall.SIGKILL)
+			t.Fatal("the grandchild survived the cancellation")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
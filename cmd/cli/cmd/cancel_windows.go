@@ -0,0 +1,15 @@
+//go:build windows
+
+package cmd
+
+import "os/exec"
+
+// setProcessGroup is a no-op on windows, where console children receive Ctrl-C themselves.
+func setProcessGroup(*exec.Cmd) {}
+
+// stopProcessGroup kills cmd; windows has no process groups to signal.
+func stopProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"platform-go-common/pkg/errors"
+	"platform-go-common/pkg/usi"
+
+	"usi/pkg/core"
+)
+
+const (
+	changeLogPath    = "/changelog"
+	changeLogTimeout = 30 * time.Second
+)
+
+// ChangeLogRequest asks the registry for up to Max revisions of a resource. Includes limits the
+// parts of each revision returned, e.g. active, data and metadata; all of them when empty.
+type ChangeLogRequest struct {
+	Resource core.Request `json:"resource"`
+	Includes []string     `json:"includes,omitempty"`
+	Max      int          `json:"max,omitempty"`
+}
+
+// ChangeLogEntry is a single revision of a resource, who wrote it and when. Resource is the
+// resource as stored in that revision.
+type ChangeLogEntry struct {
+	Revision  int                    `json:"revision"`
+	Timestamp time.Time              `json:"timestamp"`
+	Requester interface{}            `json:"requester"`
+	Active    bool                   `json:"active"`
+	Resource  map[string]interface{} `json:"resource"`
+}
+
+// ChangeLogClient returns the revisions of a resource.
+type ChangeLogClient interface {
+	ChangeLog(request ChangeLogRequest) ([]ChangeLogEntry, error)
+}
+
+// ChangeLogs returns the change log client of the configured registry. It is a variable so tests
+// can swap in a fake client.
+var ChangeLogs = func(command string) (ChangeLogClient, error) {
+	url := usi.GetOrDefault("", "registry", "url")
+	if url == "" {
+		return nil, errors.WithCode("no registry url is set, set one with usi set registry <url>", errors.BadRequest)
+	}
+	return &RegistryChangeLog{URL: url, Client: &http.Client{Timeout: changeLogTimeout}}, nil
+}
+
+// RegistryChangeLog reads change logs from the registry's change log endpoint. The workspace
+// client has no change log call, so the request is posted to the registry directly.
+type RegistryChangeLog struct {
+	URL    string
+	Client *http.Client
+}
+
+func (r *RegistryChangeLog) ChangeLog(request ChangeLogRequest) ([]ChangeLogEntry, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	response, err := r.Client.Post(strings.TrimRight(r.URL, "/")+changeLogPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, errors.WithCode("the resource has no change log in the registry", errors.NotFound)
+	}
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, fmt.Errorf("registry change log returned %s: %s", response.Status, truncate(strings.TrimSpace(string(message)), 200))
+	}
+	var entries []ChangeLogEntry
+	if err := json.NewDecoder(response.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("unable to read the registry change log: %s", err.Error())
+	}
+	return entries, nil
+}
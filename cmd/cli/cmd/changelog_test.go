@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// changeLogFixture is what the registry returns for two revisions of a deployment.
+const changeLogFixture = `[
+  {"revision": 2, "timestamp": "2026-10-01T10:00:00Z", "requester": "jdoe", "active": true,
+   "resource": {"name": "api", "data": {"configuration": {"replicas": 3}}}},
+  {"revision": 1, "timestamp": "2026-09-30T10:00:00Z", "requester": "jdoe",
+   "resource": {"name": "api", "data": {"configuration": {"replicas": 2}}}}
+]`
+
+func TestRegistryChangeLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		revisions []int
+		wantErr   string
+	}{
+		{name: "entries", status: http.StatusOK, body: changeLogFixture, revisions: []int{2, 1}},
+		{name: "no entries", status: http.StatusOK, body: `[]`},
+		{name: "unknown resource", status: http.StatusNotFound, wantErr: "no change log"},
+		{name: "registry error", status: http.StatusBadGateway, body: "upstream unavailable", wantErr: "upstream unavailable"},
+		{name: "not a change log", status: http.StatusOK, body: `{"revision": 1}`, wantErr: "unable to read"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ChangeLogRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != changeLogPath {
+					t.Errorf("request = %s %s, want POST %s", r.Method, r.URL.Path, changeLogPath)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("request body: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			changeLog := &RegistryChangeLog{URL: server.URL + "/", Client: server.Client()}
+			entries, err := changeLog.ChangeLog(ChangeLogRequest{Includes: []string{"data"}, Max: 2})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ChangeLog() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ChangeLog() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Includes, []string{"data"}) || got.Max != 2 {
+				t.Errorf("request = %+v, want includes [data] and max 2", got)
+			}
+			var revisions []int
+			for _, entry := range entries {
+				revisions = append(revisions, entry.Revision)
+			}
+			if !reflect.DeepEqual(revisions, tt.revisions) {
+				t.Errorf("ChangeLog() revisions = %v, want %v", revisions, tt.revisions)
+			}
+		})
+	}
+}
+
+func TestChangeLogEntryDiff(t *testing.T) {
+	var entries []ChangeLogEntry
+	if err := json.Unmarshal([]byte(changeLogFixture), &entries); err != nil {
+		t.Fatal(err)
+	}
+	before, err := revisionFields(entries[1].Resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := revisionFields(entries[0].Resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := DiffFields(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FieldChange{{Path: "data.configuration.replicas", Old: "2", New: "3", Modified: true}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("DiffFields() = %+v, want %+v", changes, want)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"io"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 	"usi/pkg/type/deployment"
 
@@ -20,7 +22,19 @@ import (
 	"usi/pkg/model/config"
 )
 
-const deploySpec = "[ -a=<key1=value1,key2=value2>... ] [ -d ] [ -e=<environment> ] [ -n=<name> ]  [ -r=<dir> ] [ -p=<properties> ] [ -s=<selector1[,selector2]> ] [ -t=<target> ] [-w] [ -v ] [ -l ] [ -x | --skip-post-conditions ] [ --skip-produces ] [ --clear-annotations ] [ --force ]"
+const deploySpec = "[ -a=<key1=value1,key2=value2>... ] [ -d ] [ -e=<environment> ] [ -n=<name> ]  [ -r=<dir> ] [ -p=<properties> ] [ -s=<selector1[,selector2]> ] [ -t=<target> ] [-w [ --http-ready ] ] [ -v ] [ -l ] [ -x | --skip-post-conditions ] [ --skip-produces ] [ --clear-annotations ] [ --force ] [ -y ] [ --lock-ttl=<duration> ] [ --timeout=<duration> ] [ --plan | --canary [ --verify=<command> ] ] [ --output=<format> ] [ --receipt=<file> ] [ --stack=<file> ] [ --parallel=<n> ] [ SERVICES... ]"
+
+// stackDeployConflict rejects the options that only apply to a single service. Every service of a
+// stack is deployed by its own `usi deploy` process, which doesn't get them.
+func stackDeployConflict(plan, canary, events bool, receiptFile string) error {
+	switch {
+	case plan || canary:
+		return errors.WithCode("--plan and --canary deploy a single service, they can't be combined with SERVICES or --stack", errors.BadRequest)
+	case events || receiptFile != "":
+		return errors.WithCode("--output json and --receipt deploy a single service", errors.BadRequest)
+	}
+	return nil
+}
 
 func CmdDeploy(cmd *cli.Cmd) {
 	command := "deploy"
@@ -28,8 +42,71 @@ func CmdDeploy(cmd *cli.Cmd) {
 	opts := NewOpts(cmd)
 
 	deployOpts := NewDeployOpts(opts)
+	stackFile := opts.StackOpt()
+	parallel := opts.ParallelOpt()
+	plan := opts.PlanOpt()
+	output := opts.OutputOpt()
+	canary := opts.CanaryOpt()
+	verify := opts.VerifyOpt()
+	receiptFile := opts.ReceiptOpt()
+	services := cmd.StringsArg("SERVICES", nil, "additional services to deploy together with -n, ordered by their dependencies")
+	Reporter.UsedOption("services", services)
 
 	cmd.Action = func() {
+		var events *EventStream
+		switch *output {
+		case OutputText:
+		case OutputJSON:
+			var err error
+			events, err = StartEventOutput()
+			HandleError(err, command)
+		default:
+			HandleError(errors.WithCode(fmt.Sprintf("unknown output format (%s), values are (text, json)", *output), errors.BadRequest), command)
+		}
+
+		if *stackFile != "" || len(*services) > 0 {
+			HandleError(stackDeployConflict(*plan, *canary, events != nil, *receiptFile), command)
+			opts.Normalize(command)
+			opts.Validate(command)
+			var environmentResource = &environment.Resource{}
+			ValidateAndRetrieveEnvironment(command, deployOpts.env).Remarshal(environmentResource)
+			stack := StackServices(*deployOpts.name, *services, *stackFile, command)
+			names := make([]string, 0, len(stack))
+			for _, service := range stack {
+				names = append(names, service.Name)
+			}
+			ConfirmDeploy(command, deployOpts, environmentResource, names)
+			op := StartOperation(command, deployOpts.timeout, nil)
+			op.Telemetry(map[string]interface{}{
+				"environment": deployOpts.env,
+				"services":    strings.Join(names, ","),
+				"parallel":    *parallel,
+			})
+			DeployStack(op, command, deployOpts, stack, *parallel)
+			return
+		}
+
+		if *canary {
+			opts.Normalize(command)
+			opts.Validate(command)
+			deployOpts.env = ToggleEnvironment(deployOpts.env, deployOpts.name)
+			var environmentResource = &environment.Resource{}
+			ValidateAndRetrieveEnvironment(command, deployOpts.env).Remarshal(environmentResource)
+			if *deployOpts.dryRun || events != nil || *receiptFile != "" {
+				HandleError(errors.WithCode("--canary can't be combined with -d, --output json or --receipt", errors.BadRequest), command)
+			}
+			ConfirmDeploy(command, deployOpts, environmentResource, []string{*deployOpts.name})
+			op := StartOperation(command, deployOpts.timeout, nil)
+			op.Telemetry(map[string]interface{}{
+				"environment": deployOpts.env,
+				"name":        deployOpts.name,
+				"selectors":   deployOpts.selector,
+				"canary":      "true",
+			})
+			DeployCanary(op, command, deployOpts, *verify)
+			return
+		}
+
 		if deployOpts.wait != nil && *deployOpts.wait && deployOpts.logs != nil && *deployOpts.logs {
 			PrintWarning("Will wait for deployment before outputting logs. " +
 				"You may want to remove -w to see initialization errors")
@@ -44,6 +121,9 @@ func CmdDeploy(cmd *cli.Cmd) {
 		if environmentResource.Selector.MatchesSelector(typeconst.AdditionalTestingEnvironmentSelector) && *deployOpts.selector == "" {
 			HandleError(errors.WithCode(fmt.Sprintf("You must provide an optional selector (-s) when deploying to shared team environments"), errors.BadRequest), command)
 		}
+		if !*plan {
+			ConfirmDeploy(command, deployOpts, environmentResource, []string{*deployOpts.name})
+		}
 
 		var request = deployment.ClientDeployRequest{}
 		if deployOpts.force != nil {
@@ -52,16 +132,54 @@ func CmdDeploy(cmd *cli.Cmd) {
 		properties, err := StrToConfiguration(deployOpts.props)
 		HandleError(err, command)
 
+		op := StartOperation(command, deployOpts.timeout, events)
+		op.Telemetry(map[string]interface{}{
+			"dryrun":      strconv.FormatBool(*deployOpts.dryRun),
+			"environment": deployOpts.env,
+			"name":        deployOpts.name,
+			"selectors":   deployOpts.selector,
+			"target":      deployOpts.target,
+		})
+
+		lockTTL := ParseLockTTL(deployOpts.lockTTL, command)
+
 		var outWriter, errWriter io.Writer = outOpt, errOpt
-		outOpt.SetRules(deployOutputRules)
-		errOpt.SetRules(deployOutputRules)
+		outputRules := DeployOutputRules(deployOpts.m5Dir, command)
+		outOpt.SetRules(outputRules)
+		errOpt.SetRules(outputRules)
 
 		if *deployOpts.verbose {
 			outWriter = os.Stdout
 			errWriter = os.Stderr
 		}
+		var ruleOut, ruleErr *RuleEventWriter
+		if events != nil {
+			var tee io.Writer
+			if *deployOpts.verbose {
+				tee = os.Stderr
+			}
+			ruleOut = NewRuleEventWriter(events, outputRules, tee)
+			ruleErr = NewRuleEventWriter(events, outputRules, tee)
+			outWriter, errWriter = ruleOut, ruleErr
+		}
 
+		op.Phase("build")
+		decorateStart := time.Now()
 		registryOpts, source := DecorateM5(deployOpts.name, deployOpts.env, deployOpts.m5Dir, core.DeployCmd, StrsToAnnotations(deployOpts.annotations), StrToSelector(deployOpts.selector, command), properties, deployOpts.target, outWriter, errWriter)
+		if events != nil {
+			_ = ruleOut.Close()
+			_ = ruleErr.Close()
+			scripts := make([]string, 0, len(source.ScriptTimes))
+			for script := range source.ScriptTimes {
+				scripts = append(scripts, script)
+			}
+			sort.Strings(scripts)
+			for _, script := range scripts {
+				events.EmitDuration("script", script, source.ScriptTimes[script], nil)
+			}
+			events.EmitDuration("decorate", *deployOpts.name, time.Since(decorateStart), map[string]interface{}{"path": *source.Path()})
+		}
+		op.Check(op.Err())
 		request.ProviderOptions = registryOpts
 		if *deployOpts.selector != "" {
 			source.M5.EnsureDeclaration()
@@ -71,8 +189,10 @@ func CmdDeploy(cmd *cli.Cmd) {
 		HandleError(source.M5.ReMarshal(&request), command)
 		request.Environment = EnvFromSelectorName(*deployOpts.env)
 		request.Requester = Requester()
-		request.DryRun = *deployOpts.dryRun
-		if !request.DryRun {
+		request.DryRun = *deployOpts.dryRun || *plan
+		if *plan {
+			PrintHeader("* Planning deploy via usi")
+		} else if !request.DryRun {
 			PrintHeader("* Deploying via usi")
 		} else {
 			PrintHeader("* Deploying via usi (Dry Run)")
@@ -105,9 +225,45 @@ func CmdDeploy(cmd *cli.Cmd) {
 			PrintSectionWarning(source.Warnings)
 		}
 
+		// the lock is only held from here on, so a failed build or decorate never leaves it behind
+		var lock *DeployLock
+		if !request.DryRun {
+			lock = AcquireDeployLock(command, *deployOpts.env, *deployOpts.name, *deployOpts.selector, lockTTL, request.Force)
+			op.OnAbort(lock.Release)
+		}
+		op.Phase("registry deploy")
 		deployStart := time.Now()
-		deployResponse, err := Workspace(deployOpts.target, outWriter, errWriter, command).Deploy(request)
-		HandleResolveError(command, err)
+		deployResponse, err := Await(op, Workspace(deployOpts.target, outWriter, errWriter, command).Deploy, request)
+		op.Check(err)
+		if err != nil {
+			events.Emit("result", *deployOpts.name, err.Error(), map[string]interface{}{"result": "failure", "phase": "deploy"})
+		}
+		lock.CheckResolve(command, err)
+		events.EmitDuration("deploy", deployResponse.Deployment.Name, time.Since(deployStart), map[string]interface{}{
+			"uuid":    deployResponse.Deployment.UUID,
+			"dry_run": request.DryRun,
+		})
+		if *plan {
+			current := GetServiceDeployment(command, *deployOpts.env, *deployOpts.name, StrToSelector(deployOpts.selector, command))
+			summary := PrintDeployPlan(current, deployResponse.Deployment, command)
+			events.Emit("plan", deployResponse.Deployment.Name, "", summary)
+			op.Done()
+			Reporter.SendHoneycombEvent(command, map[string]interface{}{
+				"environment": deployOpts.env,
+				"name":        deployOpts.name,
+				"selectors":   deployOpts.selector,
+				"target":      deployOpts.target,
+				"plan":        "true",
+				"plan_add":    summary.Add,
+				"plan_change": summary.Change,
+				"plan_remove": summary.Destroy,
+				"result":      "success",
+			})
+			if summary.HasChanges() {
+				os.Exit(PlanChangesExitCode)
+			}
+			return
+		}
 		if *deployOpts.dryRun {
 			PrintYAML(deployResponse.Deployment, command)
 		}
@@ -121,17 +277,32 @@ func CmdDeploy(cmd *cli.Cmd) {
 		PrintHeader("Completed Deployment: %s (%s) in %vs", deployResponse.Deployment.Name, deployResponse.Deployment.UUID, roundFloat(deploymentDuration.Seconds(), 3))
 
 		if deployOpts.skipPostConditions == nil || (deployOpts.skipPostConditions != nil && !*deployOpts.skipPostConditions) {
-			if err := Workspace(deployOpts.target, outWriter, errWriter, command).Postconditions(*deployOpts.env, source, core.DeployCmd); err != nil {
-				HandleError(err, command)
+			op.Phase("postconditions")
+			postconditionsStart := time.Now()
+			err := Workspace(deployOpts.target, outWriter, errWriter, command).Postconditions(*deployOpts.env, source, core.DeployCmd)
+			op.Check(op.Err())
+			if err != nil {
+				events.Emit("result", *deployOpts.name, err.Error(), map[string]interface{}{"result": "failure", "phase": "postconditions"})
+				lock.Check(err, command)
 			}
+			events.EmitDuration("postconditions", *deployOpts.name, time.Since(postconditionsStart), nil)
 		}
+		lock.Release()
 
 		fmt.Println("__________________________________________________________________")
 
 		producedKeys, found := ExtractAndPrintProducedKValuePairs(deployResponse.Deployment.Data.Configuration, deployResponse.Deployment.Data.Declaration)
+		events.Emit("produced", deployResponse.Deployment.Name, "", producedKeys)
+		receipt := NewDeployReceipt(deployResponse.Deployment, *deployOpts.env, *deployOpts.selector, *deployOpts.target, request.DryRun)
+		receipt.ProducedKeys = producedKeys
+		receipt.DeploymentDurationS = deploymentDuration.Seconds()
+		for script, timing := range source.ScriptTimes {
+			receipt.ScriptTimesS[script] = timing.Seconds()
+		}
 
 		if deployResponse.Deployment.Links != nil && len(deployResponse.Deployment.Links) > 0 {
 			PrintLinks(deployResponse.Deployment.Links)
+			events.Emit("links", deployResponse.Deployment.Name, "", deployResponse.Deployment.Links)
 		}
 
 		if !request.DryRun {
@@ -143,6 +314,8 @@ func CmdDeploy(cmd *cli.Cmd) {
 		if deployResponse.Warnings != nil {
 			for _, warning := range deployResponse.Warnings {
 				PrintWarning(warning)
+				events.Emit("warning", deployResponse.Deployment.Name, warning, nil)
+				receipt.Warnings = append(receipt.Warnings, warning)
 			}
 		}
 		HandleDeployWarning(deployResponse, command)
@@ -179,7 +352,16 @@ func CmdDeploy(cmd *cli.Cmd) {
 		fmt.Println("") // Extra new line before waiting / adding the wait warning
 		// Start waiting after fully completing the deployment
 		if deployOpts.wait != nil && *deployOpts.wait {
-			waitDur := WaitForDeployment(deployResponse.Deployment, *deployOpts.env, command)
+			op.Phase("wait")
+			waitDur := WaitForDeploymentContext(op.Context(), deployResponse.Deployment, *deployOpts.env, command)
+			if *deployOpts.httpReady {
+				op.Phase("http ready")
+				waitDur += WaitForDeploymentReady(op.Context(), deployResponse.Deployment, command)
+			}
+			op.Check(op.Err())
+			events.EmitDuration("wait", deployResponse.Deployment.Name, waitDur, nil)
+			waitSeconds := waitDur.Seconds()
+			receipt.WaitDurationS = &waitSeconds
 
 			// add wait durations to reported metrics
 			honeyCombMap["wait_duration_s"] = waitDur.Seconds()
@@ -191,6 +373,19 @@ func CmdDeploy(cmd *cli.Cmd) {
 				" your application service URL may not be accessible immediately post usi deploy.")
 		}
 
+		op.Done()
+		if *receiptFile != "" {
+			HandleError(receipt.Write(*receiptFile), command)
+			PrintHeader("Receipt written to %s", *receiptFile)
+		}
+		if events != nil {
+			_ = ruleOut.Close()
+			_ = ruleErr.Close()
+			events.EmitDuration("result", deployResponse.Deployment.Name, deploymentDuration, map[string]interface{}{
+				"result": "success",
+				"uuid":   deployResponse.Deployment.UUID,
+			})
+		}
 		Reporter.SendHoneycombEvent(command, honeyCombMap)
 		Reporter.SendSnowflakeEvent(command, snowflakeMap)
 
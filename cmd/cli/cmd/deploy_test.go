@@ -0,0 +1,30 @@
+package cmd
+
+import "testing"
+
+// A stack deploys every service with its own `usi deploy` process that isn't given --plan or
+// --canary, so accepting them would deploy for real instead of planning or verifying a canary.
+func TestStackDeployConflict(t *testing.T) {
+	tests := []struct {
+		name        string
+		plan        bool
+		canary      bool
+		events      bool
+		receiptFile string
+		wantErr     bool
+	}{
+		{name: "plain stack"},
+		{name: "plan", plan: true, wantErr: true},
+		{name: "canary", canary: true, wantErr: true},
+		{name: "json output", events: true, wantErr: true},
+		{name: "receipt", receiptFile: "receipt.json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := stackDeployConflict(tt.plan, tt.canary, tt.events, tt.receiptFile)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("stackDeployConflict() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
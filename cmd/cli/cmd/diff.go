@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldChange is a single leaf value that differs between two versions of a resource.
+// Old is empty for added fields and New is empty for removed ones.
+type FieldChange struct {
+	Path     string
+	Old      string
+	New      string
+	Added    bool
+	Removed  bool
+	Modified bool
+}
+
+// FlattenFields turns any JSON-serializable value into leaf paths such as
+// configuration.properties[DB_HOST].value. List entries that carry a key or name
+// are addressed by it so reordering a list does not show up as a change.
+func FlattenFields(v interface{}) (map[string]string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	flattenInto(fields, "", generic)
+	return fields, nil
+}
+
+func flattenInto(fields map[string]string, path string, v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, value := range t {
+			if path == "" {
+				flattenInto(fields, key, value)
+			} else {
+				flattenInto(fields, path+"."+key, value)
+			}
+		}
+	case []interface{}:
+		for i, value := range t {
+			key, field := elementKey(i, value)
+			if field == "" {
+				flattenInto(fields, path+"["+key+"]", value)
+				continue
+			}
+			// the key is already part of the path, only the remaining fields are leaves
+			rest := make(map[string]interface{}, len(value.(map[string]interface{})))
+			for k, v := range value.(map[string]interface{}) {
+				if k != field {
+					rest[k] = v
+				}
+			}
+			if len(rest) == 0 {
+				fields[path+"["+key+"]"] = key
+				continue
+			}
+			flattenInto(fields, path+"["+key+"]", rest)
+		}
+	case nil:
+		// absent and null are the same thing for a diff
+	case string:
+		fields[path] = t
+	default:
+		b, _ := json.Marshal(t)
+		fields[path] = string(b)
+	}
+}
+
+// elementKey returns how a list entry is addressed and, for keyed entries, the field holding the key.
+func elementKey(i int, v interface{}) (string, string) {
+	if m, ok := v.(map[string]interface{}); ok {
+		for _, field := range []string{"key", "envKey", "env_key", "name"} {
+			if s, ok := m[field].(string); ok && s != "" {
+				return s, field
+			}
+		}
+	}
+	return strconv.Itoa(i), ""
+}
+
+// DiffFields compares two values field by field. The changes are sorted by path.
+func DiffFields(before, after interface{}) ([]FieldChange, error) {
+	old, err := FlattenFields(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := FlattenFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FieldChange
+	for path, oldValue := range old {
+		newValue, ok := updated[path]
+		switch {
+		case !ok:
+			changes = append(changes, FieldChange{Path: path, Old: oldValue, Removed: true})
+		case newValue != oldValue:
+			changes = append(changes, FieldChange{Path: path, Old: oldValue, New: newValue, Modified: true})
+		}
+	}
+	for path, newValue := range updated {
+		if _, ok := old[path]; !ok {
+			changes = append(changes, FieldChange{Path: path, New: newValue, Added: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// PrintFieldChanges writes one line per change, indented by prefix.
+func PrintFieldChanges(w io.Writer, changes []FieldChange, prefix string) {
+	if len(changes) == 0 {
+		_, _ = fmt.Fprintf(w, "%s(no changes)\n", prefix)
+		return
+	}
+	for _, change := range changes {
+		switch {
+		case change.Added:
+			_, _ = fmt.Fprintf(w, "%s+ %s: %s\n", prefix, change.Path, change.New)
+		case change.Removed:
+			_, _ = fmt.Fprintf(w, "%s- %s: %s\n", prefix, change.Path, change.Old)
+		default:
+			_, _ = fmt.Fprintf(w, "%s~ %s: %s -> %s\n", prefix, change.Path, change.Old, change.New)
+		}
+	}
+}
+
+// registryFields are kept up to date by the registry rather than written by a deploy, and
+// revisionMetaData is the bookkeeping it adds to every revision, shown on the entry itself.
+var (
+	registryFields   = []string{"uuid", "links", "kubernetes", "cluster", "active"}
+	revisionMetaData = []string{"revision", "timestamp", "requester"}
+)
+
+// revisionFields keeps what changes between revisions of a stored resource, e.g. its name,
+// selectors, data and metadata, and leaves out the state the registry maintains.
+func revisionFields(resource interface{}) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	if err := remarshal(resource, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return map[string]interface{}{}, nil
+	}
+	for _, field := range registryFields {
+		delete(fields, field)
+	}
+	if metadata, ok := fields["metadata"].(map[string]interface{}); ok {
+		for _, field := range revisionMetaData {
+			delete(metadata, field)
+		}
+	}
+	return fields, nil
+}
+
+// remarshal copies v into out through JSON, e.g. a stored resource into a request.
+func remarshal(v interface{}, out interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+func truncate(s string, max int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
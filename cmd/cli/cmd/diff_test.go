@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestFlattenFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  map[string]string
+	}{
+		{name: "nil", value: nil, want: map[string]string{}},
+		{name: "nested", value: map[string]interface{}{"a": map[string]interface{}{"b": "c", "n": 1.5, "t": true}},
+			want: map[string]string{"a.b": "c", "a.n": "1.5", "a.t": "true"}},
+		{name: "null leaves", value: map[string]interface{}{"a": nil, "b": "x"}, want: map[string]string{"b": "x"}},
+		{name: "plain list", value: map[string]interface{}{"hosts": []interface{}{"a", "b"}},
+			want: map[string]string{"hosts[0]": "a", "hosts[1]": "b"}},
+		{name: "keyed list", value: map[string]interface{}{"properties": []interface{}{
+			map[string]interface{}{"key": "DB_HOST", "value": "db"},
+			map[string]interface{}{"name": "PORT", "value": 5432},
+		}}, want: map[string]string{"properties[DB_HOST].value": "db", "properties[PORT].value": "5432"}},
+		{name: "key only entries", value: map[string]interface{}{"selectors": []interface{}{
+			map[string]interface{}{"name": "feature"},
+		}}, want: map[string]string{"selectors[feature]": "feature"}},
+		{name: "struct", value: struct {
+			Name  string `json:"name"`
+			Count int    `json:"count,omitempty"`
+		}{Name: "api"}, want: map[string]string{"name": "api"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FlattenFields(tt.value)
+			if err != nil {
+				t.Fatalf("FlattenFields() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FlattenFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	before := map[string]interface{}{
+		"replicas": 2,
+		"image":    "api:1",
+		"properties": []interface{}{
+			map[string]interface{}{"key": "A", "value": "1"},
+			map[string]interface{}{"key": "B", "value": "2"},
+		},
+	}
+	tests := []struct {
+		name  string
+		after interface{}
+		want  []FieldChange
+	}{
+		{name: "unchanged", after: before},
+		{name: "reordered list", after: map[string]interface{}{
+			"replicas": 2,
+			"image":    "api:1",
+			"properties": []interface{}{
+				map[string]interface{}{"key": "B", "value": "2"},
+				map[string]interface{}{"key": "A", "value": "1"},
+			},
+		}},
+		{name: "changes", after: map[string]interface{}{
+			"replicas": 3,
+			"properties": []interface{}{
+				map[string]interface{}{"key": "A", "value": "1"},
+				map[string]interface{}{"key": "C", "value": "3"},
+			},
+		}, want: []FieldChange{
+			{Path: "image", Old: "api:1", Removed: true},
+			{Path: "properties[B].value", Old: "2", Removed: true},
+			{Path: "properties[C].value", New: "3", Added: true},
+			{Path: "replicas", Old: "2", New: "3", Modified: true},
+		}},
+		{name: "from nothing", after: nil, want: []FieldChange{
+			{Path: "image", Old: "api:1", Removed: true},
+			{Path: "properties[A].value", Old: "1", Removed: true},
+			{Path: "properties[B].value", Old: "2", Removed: true},
+			{Path: "replicas", Old: "2", Removed: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiffFields(before, tt.after)
+			if err != nil {
+				t.Fatalf("DiffFields() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffFields() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintFieldChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []FieldChange
+		want    string
+	}{
+		{name: "none", want: "  (no changes)\n"},
+		{name: "all kinds", changes: []FieldChange{
+			{Path: "a", New: "1", Added: true},
+			{Path: "b", Old: "2", Removed: true},
+			{Path: "c", Old: "3", New: "4", Modified: true},
+		}, want: "  + a: 1\n  - b: 2\n  ~ c: 3 -> 4\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			PrintFieldChanges(&buf, tt.changes, "  ")
+			if buf.String() != tt.want {
+				t.Errorf("PrintFieldChanges() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRevisionFields(t *testing.T) {
+	resource := map[string]interface{}{
+		"uuid":       "0b5e",
+		"name":       "api",
+		"selectors":  []interface{}{"feature"},
+		"active":     true,
+		"data":       map[string]interface{}{"configuration": map[string]interface{}{"replicas": 2}},
+		"metadata":   map[string]interface{}{"annotations": map[string]interface{}{"team": "core"}, "owner": "core", "revision": 7},
+		"links":      map[string]interface{}{"ui": "https://api.example.com"},
+		"kubernetes": map[string]interface{}{"status": "running"},
+		"cluster":    "us-east-1",
+	}
+	got, err := revisionFields(resource)
+	if err != nil {
+		t.Fatalf("revisionFields() error = %v", err)
+	}
+	fields, _ := FlattenFields(got)
+	want := map[string]string{
+		"name":                        "api",
+		"selectors[0]":                "feature",
+		"data.configuration.replicas": "2",
+		"metadata.annotations.team":   "core",
+		"metadata.owner":              "core",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("revisionFields() = %v, want %v", fields, want)
+	}
+
+	empty, err := revisionFields(nil)
+	if err != nil {
+		t.Fatalf("revisionFields(nil) error = %v", err)
+	}
+	if fields, _ := FlattenFields(empty); len(fields) != 0 {
+		t.Errorf("revisionFields(nil) = %v, want no fields", fields)
+	}
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// DeployEvent is one line of `deploy --output json`.
+type DeployEvent struct {
+	Time      time.Time   `json:"time"`
+	Phase     string      `json:"phase"`
+	Name      string      `json:"name,omitempty"`
+	Message   string      `json:"message,omitempty"`
+	DurationS *float64    `json:"duration_s,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// EventStream writes deploy events as newline delimited JSON. A nil stream discards events, so
+// callers don't need to check whether json output was requested.
+type EventStream struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewEventStream(w io.Writer) *EventStream {
+	return &EventStream{encoder: json.NewEncoder(w)}
+}
+
+func (s *EventStream) Emit(phase, name, message string, data interface{}) {
+	s.emit(DeployEvent{Phase: phase, Name: name, Message: message, Data: data})
+}
+
+func (s *EventStream) EmitDuration(phase, name string, duration time.Duration, data interface{}) {
+	seconds := roundFloat(duration.Seconds(), 3)
+	s.emit(DeployEvent{Phase: phase, Name: name, DurationS: &seconds, Data: data})
+}
+
+func (s *EventStream) emit(event DeployEvent) {
+	if s == nil {
+		return
+	}
+	event.Time = time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.encoder.Encode(event)
+}
+
+// StartEventOutput returns a stream on the real stdout and sends everything else written to
+// stdout to stderr from then on, so stdout only carries events. That includes writers that took
+// os.Stdout before, such as ColoredOutput, and the scripts a deploy runs.
+func StartEventOutput() (*EventStream, error) {
+	stdout, err := redirectStdout()
+	if err != nil {
+		return nil, err
+	}
+	return NewEventStream(stdout), nil
+}
+
+// RuleEventWriter turns the lines of a deploy's script output that match an OutputRule into
+// step events, measuring steps that need timing until the next step starts.
+type RuleEventWriter struct {
+	events  *EventStream
+	rules   map[string]OutputRule
+	names   []string
+	tee     io.Writer
+	buf     []byte
+	open    string
+	started time.Time
+}
+
+// NewRuleEventWriter matches lines against rules; every line is also copied to tee when it isn't nil.
+func NewRuleEventWriter(events *EventStream, rules map[string]OutputRule, tee io.Writer) *RuleEventWriter {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &RuleEventWriter{events: events, rules: rules, names: names, tee: tee}
+}
+
+func (w *RuleEventWriter) Write(b []byte) (int, error) {
+	if w.tee != nil {
+		_, _ = w.tee.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		w.line(strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Close handles a trailing partial line and ends a step still being timed.
+func (w *RuleEventWriter) Close() error {
+	if len(w.buf) > 0 {
+		w.line(string(w.buf))
+		w.buf = nil
+	}
+	w.closeTiming()
+	return nil
+}
+
+func (w *RuleEventWriter) line(line string) {
+	for _, name := range w.names {
+		rule := w.rules[name]
+		if rule.Hook == "" || !strings.Contains(line, rule.Hook) {
+			continue
+		}
+		value := ""
+		if rule.Pattern != nil {
+			m := rule.Pattern.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			if len(m) > 1 {
+				value = m[1]
+			}
+		}
+		w.match(name, rule, line, value)
+		return
+	}
+}
+
+func (w *RuleEventWriter) match(name string, rule OutputRule, line, value string) {
+	phase := ruleTypePhase(rule)
+	switch phase {
+	case "step_timing", "sub_step_timing":
+		if seconds, ok := parseElapsed(value); ok {
+			w.events.EmitDuration(phase, name, time.Duration(seconds*float64(time.Second)), nil)
+		}
+		return
+	case "step", "sub_step":
+		w.closeTiming()
+	}
+
+	message := rule.Msg
+	if strings.Contains(message, "%") {
+		message = fmt.Sprintf(message, value)
+	}
+	for suffix, prefix := range rule.Prefixes {
+		if strings.HasSuffix(value, suffix) {
+			message = prefix + message
+			break
+		}
+	}
+	if message == "" {
+		message = line
+	}
+	w.events.Emit(phase, name, strings.TrimSpace(message), nil)
+	if rule.NeedTiming {
+		w.open = name
+		w.started = time.Now()
+	}
+}
+
+func (w *RuleEventWriter) closeTiming() {
+	if w.open == "" {
+		return
+	}
+	w.events.EmitDuration("sub_step_timing", w.open, time.Since(w.started), nil)
+	w.open = ""
+}
+
+func ruleTypePhase(rule OutputRule) string {
+	switch rule.Type {
+	case Step:
+		return "step"
+	case StepTiming:
+		return "step_timing"
+	case SubStep:
+		return "sub_step"
+	case SubStepFollower:
+		return "sub_step_follower"
+	case SubStepTiming:
+		return "sub_step_timing"
+	default:
+		return "message"
+	}
+}
+
+// parseElapsed reads timings such as "12.5s", "1m3s" or a plain number of seconds.
+func parseElapsed(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if d, err := time.ParseDuration(value); err == nil {
+		return d.Seconds(), true
+	}
+	if seconds, err := strconv.ParseFloat(strings.TrimSuffix(value, "s"), 64); err == nil {
+		return seconds, true
+	}
+	return 0, false
+}
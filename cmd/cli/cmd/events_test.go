@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+var testEventRules = map[string]OutputRule{
+	"script": {
+		Hook:     "Running script: ",
+		Pattern:  regexp.MustCompile("Running script: (.+)$"),
+		Type:     Step,
+		Prefixes: map[string]string{"/build.sh": "BUILDING "},
+		Msg:      "via: %s",
+	},
+	"script_elapsed": {
+		Hook:    "Script elapsed time: ",
+		Pattern: regexp.MustCompile("Script elapsed time: (.+)$"),
+		Type:    StepTiming,
+		Msg:     "Elapsed: %vs",
+	},
+	"rsync": {
+		Hook:       "RSyncing",
+		Type:       SubStep,
+		Msg:        "  - RSyncing templates",
+		NeedTiming: true,
+	},
+	"notice": {
+		Hook: "NOTICE",
+		Type: Msg,
+	},
+}
+
+func decodeEvents(t *testing.T, b []byte) []DeployEvent {
+	t.Helper()
+	var events []DeployEvent
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	for decoder.More() {
+		var event DeployEvent
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestRuleEventWriter(t *testing.T) {
+	type event struct {
+		Phase    string
+		Name     string
+		Message  string
+		Duration bool
+	}
+	tests := []struct {
+		name   string
+		writes []string
+		want   []event
+	}{
+		{name: "no match", writes: []string{"compiling\n", "done\n"}},
+		{name: "step with prefix", writes: []string{"Running script: /ws/build.sh\n"},
+			want: []event{{Phase: "step", Name: "script", Message: "BUILDING via: /ws/build.sh"}}},
+		{name: "line split across writes", writes: []string{"Running scr", "ipt: /ws/run.sh\r\n"},
+			want: []event{{Phase: "step", Name: "script", Message: "via: /ws/run.sh"}}},
+		{name: "step timing", writes: []string{"Script elapsed time: 1m3s\n"},
+			want: []event{{Phase: "step_timing", Name: "script_elapsed", Duration: true}}},
+		{name: "unparsable timing", writes: []string{"Script elapsed time: soon\n"}},
+		{name: "message falls back to the line", writes: []string{"NOTICE disk almost full\n"},
+			want: []event{{Phase: "message", Name: "notice", Message: "NOTICE disk almost full"}}},
+		{name: "timed sub step ends at the next step", writes: []string{"RSyncing in /ws\n", "Running script: /ws/sync.sh\n"},
+			want: []event{
+				{Phase: "sub_step", Name: "rsync", Message: "- RSyncing templates"},
+				{Phase: "sub_step_timing", Name: "rsync", Duration: true},
+				{Phase: "step", Name: "script", Message: "via: /ws/sync.sh"},
+			}},
+		{name: "partial line and open timing flushed on close", writes: []string{"RSyncing in /ws"},
+			want: []event{
+				{Phase: "sub_step", Name: "rsync", Message: "- RSyncing templates"},
+				{Phase: "sub_step_timing", Name: "rsync", Duration: true},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, tee bytes.Buffer
+			w := NewRuleEventWriter(NewEventStream(&out), testEventRules, &tee)
+			input := ""
+			for _, s := range tt.writes {
+				n, err := w.Write([]byte(s))
+				if err != nil || n != len(s) {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+				input += s
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if tee.String() != input {
+				t.Errorf("tee = %q, want %q", tee.String(), input)
+			}
+			var got []event
+			for _, e := range decodeEvents(t, out.Bytes()) {
+				got = append(got, event{Phase: e.Phase, Name: e.Name, Message: e.Message, Duration: e.DurationS != nil})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseElapsed(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		ok    bool
+	}{
+		{value: "12.5s", want: 12.5, ok: true},
+		{value: "1m3s", want: 63, ok: true},
+		{value: " 4 ", want: 4, ok: true},
+		{value: "soon", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseElapsed(tt.value)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("parseElapsed(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
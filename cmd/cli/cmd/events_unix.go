@@ -0,0 +1,25 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// redirectStdout points file descriptor 1 at stderr and returns a new file on the original stdout.
+// Everything holding fd 1, the os.Stdout of this process and of its children, ends up on stderr.
+func redirectStdout() (*os.File, error) {
+	stdout := int(os.Stdout.Fd())
+	fd, err := unix.Dup(stdout)
+	if err != nil {
+		return nil, err
+	}
+	unix.CloseOnExec(fd)
+	if err := unix.Dup2(int(os.Stderr.Fd()), stdout); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "/dev/stdout"), nil
+}
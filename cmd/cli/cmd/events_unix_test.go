@@ -0,0 +1,82 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+const eventOutputEnv = "USI_TEST_EVENT_OUTPUT"
+
+// deployWithEventOutput writes to stdout the ways a deploy with --output json does: a writer that
+// took os.Stdout before the events started, like ColoredOutput, fmt, a script whose output is matched
+// against the output rules and a child writing straight to the inherited stdout.
+func deployWithEventOutput() error {
+	colored := os.Stdout
+	events, err := StartEventOutput()
+	if err != nil {
+		return err
+	}
+	events.Emit("start", "api", "", nil)
+	fmt.Println("* Deploying via usi")
+	_, _ = fmt.Fprintln(colored, "Watching deployment rollout of api ...")
+
+	rules := NewRuleEventWriter(events, testEventRules, nil)
+	script := exec.Command("sh", "-c", `echo "Running script: /ws/build.sh"; echo compiling`)
+	script.Stdout = rules
+	if err := script.Run(); err != nil {
+		return err
+	}
+	_ = rules.Close()
+	child := exec.Command("sh", "-c", "echo postconditions passed")
+	child.Stdout = os.Stdout
+	if err := child.Run(); err != nil {
+		return err
+	}
+	events.EmitDuration("result", "api", time.Second, map[string]interface{}{"result": "success"})
+	return nil
+}
+
+func TestEventOutputKeepsStdoutJSON(t *testing.T) {
+	if os.Getenv(eventOutputEnv) != "" {
+		if err := deployWithEventOutput(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^TestEventOutputKeepsStdoutJSON$")
+	cmd.Env = append(os.Environ(), eventOutputEnv+"=1")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("deploy failed: %v\n%s", err, stderr.String())
+	}
+
+	var phases []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		var event DeployEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Errorf("stdout line %q is not an event: %v", line, err)
+			continue
+		}
+		phases = append(phases, event.Phase)
+	}
+	if got := strings.Join(phases, ","); got != "start,step,result" {
+		t.Errorf("event phases = %s, want start,step,result", got)
+	}
+	for _, human := range []string{"* Deploying via usi", "Watching deployment rollout", "postconditions passed"} {
+		if !strings.Contains(stderr.String(), human) {
+			t.Errorf("stderr = %q, want it to contain %q", stderr.String(), human)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package cmd
+
+import "os"
+
+// redirectStdout swaps os.Stdout for stderr and returns the original stdout. Windows can't point
+// an open handle elsewhere, so writers that took os.Stdout before keep writing to the real stdout.
+func redirectStdout() (*os.File, error) {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	return stdout, nil
+}
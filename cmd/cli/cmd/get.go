@@ -3,7 +3,10 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"/usi/pkg/core"
 
@@ -27,7 +30,7 @@ import (
 
 func CmdGet(cmd *cli.Cmd) {
 	cmd.Command("annotations", "display annotations", CmdGetAnnotations)
-	//cmd.Command("changelog", "change history for a resource", CmdGetChangeLog)
+	cmd.Command("changelog", "change history for a resource", CmdGetChangeLog)
 	cmd.Command("clusters", "list clusters", CmdListClusters)
 	cmd.Command("configuration", "display configuration", CmdGetConfiguration)
 	cmd.Command("dependencies", "list a deployment's dependencies", CmdDependencies)
@@ -58,16 +61,120 @@ type Deployment struct {
 	Properties *[]config.PropertyDeclaration `json:"map,omitempty"`
 }
 
+var changeLogIncludes = map[string]bool{"active": true, "data": true, "metadata": true}
+
 func CmdGetChangeLog(cmd *cli.Cmd) {
-	//cmd.Spec = " ( -u=<uuid> |  (-n=<name> [-e=<environment>] ) ) -i -m "
-	//name := NameOpt(cmd)
-	//environmentName := EnvironmentOpt(cmd)
-	//uuid := UUIDOpt(cmd)
-	//includes := IncludesOpt(cmd)
-	//max := MaxOpt(cmd)
-	//cmd.Action = func() {
-	//	var request registry.ChangeLogRequest
-	//}
+	cmd.Spec = " ( -u=<uuid> | (-n=<name> [-e=<environment>]) | -e=<environment> ) [ -i=<include> ] [ -m=<max> ] "
+	opts := NewOpts(cmd)
+	name := opts.NameOpt()
+	environmentName := opts.EnvironmentOpt()
+	uuid := opts.UUIDOpt()
+	includes := opts.IncludesOpt()
+	max := opts.MaxOpt()
+	command := "get changelog"
+
+	cmd.Action = func() {
+		opts.Normalize(command)
+		opts.Validate(command)
+
+		var include []string
+		if *includes != "" {
+			for _, i := range strings.Split(*includes, ",") {
+				i = strings.ToLower(strings.TrimSpace(i))
+				if !changeLogIncludes[i] {
+					HandleError(errors.WithCode(fmt.Sprintf("unknown include (%s), values are (active, data, metadata)", i), errors.BadRequest), command)
+				}
+				include = append(include, i)
+			}
+		}
+		limit := *max
+		if limit <= 0 {
+			limit = defaultRevisions
+		}
+
+		var request core.Request
+		var title string
+		switch {
+		case *uuid != "":
+			request = core.RequestFromUUID(*uuid)
+			title = *uuid
+		case *name != "":
+			environmentName = ToggleEnvironment(environmentName, name)
+			_ = ValidateAndRetrieveEnvironment(command, environmentName)
+			serviceName, serviceSelector, err := core.ParseSelectorName(*name)
+			HandleError(err, command)
+			AssertDeployment(command, *environmentName, core.JoinNameAndSelector(serviceName, serviceSelector))
+			title = *deployment.Name(*environmentName, serviceName, serviceSelector)
+			request = core.RequestFromTypeAndNameAndSelector(deployment.TypeName, title, nil)
+		default:
+			_ = ValidateAndRetrieveEnvironment(command, environmentName)
+			title = *environmentName
+			request = core.RequestFromTypeAndNameAndSelector(environment.TypeName, title, nil)
+		}
+
+		// one extra entry is fetched as the baseline for the oldest change shown
+		entries := ChangeLog(command, request, include, limit+1)
+		PrintHeader("Change Log: %s", title)
+		if len(entries) == 0 {
+			fmt.Println("No changes recorded for the given resource.")
+		}
+		PrintChangeLog(entries, limit, command)
+		PrintFooter()
+		Reporter.SendHoneycombEvent(command, map[string]interface{}{
+			"environment":  environmentName,
+			"service_name": name,
+			"uuid":         uuid,
+			"include":      includes,
+			"max":          max,
+			"result":       "success",
+		})
+		Reporter.SendSnowflakeEvent("get", map[string]interface{}{
+			"secondary_command_get_set": "changelog",
+			"service_name":              *name,
+			"additional_info":           " uuid:" + *uuid + " include:" + *includes + " max:" + strconv.Itoa(*max),
+			"environment":               *environmentName,
+		})
+	}
+}
+
+// ChangeLog returns up to max change log entries for a resource, newest first.
+func ChangeLog(command string, resource core.Request, includes []string, max int) []ChangeLogEntry {
+	changeLogs, err := ChangeLogs(command)
+	HandleError(err, command)
+	entries, err := changeLogs.ChangeLog(ChangeLogRequest{Resource: resource, Includes: includes, Max: max})
+	HandleError(err, command)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Revision > entries[j].Revision
+	})
+	return entries
+}
+
+// PrintChangeLog prints who changed what and when for up to limit entries, each diffed against the
+// entry before it. An entry without a predecessor is shown as created.
+func PrintChangeLog(entries []ChangeLogEntry, limit int, command string) {
+	for i, entry := range entries {
+		if i >= limit {
+			break
+		}
+		marker := ""
+		if entry.Active {
+			marker = " (active)"
+		}
+		fmt.Printf("Revision %d%s: %s by %v\n", entry.Revision, marker,
+			ConvertDateToLocalTZ(entry.Timestamp).Format(time.RFC1123), entry.Requester)
+		var previous interface{}
+		if i+1 < len(entries) {
+			previous = entries[i+1].Resource
+		}
+		before, err := revisionFields(previous)
+		HandleError(err, command)
+		after, err := revisionFields(entry.Resource)
+		HandleError(err, command)
+		changes, err := DiffFields(before, after)
+		HandleError(err, command)
+		PrintFieldChanges(os.Stdout, changes, "  ")
+		fmt.Println("")
+	}
 }
 
 func CmdGetLinks(cmd *cli.Cmd) {
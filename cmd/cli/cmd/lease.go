@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+const (
+	leaseTimeout = 30 * time.Second
+	// leaseAttempts bounds the retries when another usi changes the same lease concurrently
+	leaseAttempts = 3
+
+	leaseNamePrefix           = "usi-deploy-"
+	leaseDeploymentAnnotation = "usi/deployment"
+)
+
+// DeployLeases returns the lease client for the deployments of an environment. It is a variable
+// so tests can swap in a fake client.
+var DeployLeases = func(command, environmentName string) (LeaseClient, error) {
+	envK8s := GetEnvironmentKubernetes(command, environmentName)
+	client, err := NewKubernetesClient(envK8s)
+	if err != nil {
+		return nil, err
+	}
+	return &KubernetesLeases{Client: client, Namespace: environmentNamespace(envK8s)}, nil
+}
+
+// KubernetesLeases keeps deploy leases as coordination.k8s.io Leases in the namespace of the
+// environment, one per deployment. Updates rely on the Lease's resourceVersion, so two usi
+// processes racing for the same deployment can't both take it.
+type KubernetesLeases struct {
+	Client    k8s.Interface
+	Namespace string
+	// Now defaults to time.Now
+	Now func() time.Time
+}
+
+func (l *KubernetesLeases) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now()
+}
+
+// AcquireLease creates, renews or takes over the Lease of request.Deployment. A Lease that another
+// holder renewed within its duration is only taken over with request.Force.
+func (l *KubernetesLeases) AcquireLease(request LeaseRequest) (*Lease, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseTimeout)
+	defer cancel()
+	leases := l.Client.CoordinationV1().Leases(l.Namespace)
+	name := LeaseName(request.Deployment)
+
+	var err error
+	for attempt := 0; attempt < leaseAttempts; attempt++ {
+		now := l.now()
+		var existing *coordinationv1.Lease
+		existing, err = leases.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			created := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   l.Namespace,
+				Labels:      map[string]string{"app.kubernetes.io/managed-by": "usi"},
+				Annotations: map[string]string{leaseDeploymentAnnotation: request.Deployment},
+			}}
+			setLeaseHolder(created, request, now, true)
+			created, err = leases.Create(ctx, created, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return leaseOf(created), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		current := leaseOf(existing)
+		if current.Holder != request.Holder && now.Before(current.ExpiresAt) && !request.Force {
+			return current, fmt.Errorf("%s is locked by %s", request.Deployment, current.Holder)
+		}
+		setLeaseHolder(existing, request, now, current.Holder != request.Holder || !now.Before(current.ExpiresAt))
+		var updated *coordinationv1.Lease
+		updated, err = leases.Update(ctx, existing, metav1.UpdateOptions{})
+		if apierrors.IsConflict(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return leaseOf(updated), nil
+	}
+	return nil, fmt.Errorf("the lease of %s kept changing: %s", request.Deployment, err.Error())
+}
+
+// ReleaseLease deletes the Lease when request.Holder still holds it, and leaves a lease that was
+// taken over in the meantime alone.
+func (l *KubernetesLeases) ReleaseLease(request LeaseRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseTimeout)
+	defer cancel()
+	leases := l.Client.CoordinationV1().Leases(l.Namespace)
+	name := LeaseName(request.Deployment)
+	existing, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if leaseOf(existing).Holder != request.Holder {
+		return nil
+	}
+	err = leases.Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &existing.ResourceVersion},
+	})
+	if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+		return nil
+	}
+	return err
+}
+
+// LeaseName turns a deployment name into a valid Lease name, e.g. usi-deploy-api.feature-dev.
+func LeaseName(deploymentName string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, deploymentName)
+	name = leaseNamePrefix + strings.Trim(name, "-.")
+	if len(name) > 253 {
+		name = strings.TrimRight(name[:253], "-.")
+	}
+	return name
+}
+
+// setLeaseHolder records request.Holder as renewing the lease now. A new holder also gets a new
+// acquire time, which Lease.Since reports.
+func setLeaseHolder(lease *coordinationv1.Lease, request LeaseRequest, now time.Time, newHolder bool) {
+	holder := request.Holder
+	seconds := int32(request.TTL / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	renewed := metav1.NewMicroTime(now)
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &renewed
+	if newHolder || lease.Spec.AcquireTime == nil {
+		acquired := metav1.NewMicroTime(now)
+		lease.Spec.AcquireTime = &acquired
+		transitions := int32(0)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+}
+
+func leaseOf(lease *coordinationv1.Lease) *Lease {
+	var current Lease
+	if lease.Spec.HolderIdentity != nil {
+		current.Holder = *lease.Spec.HolderIdentity
+	}
+	if lease.Spec.AcquireTime != nil {
+		current.Since = lease.Spec.AcquireTime.Time
+	}
+	if lease.Spec.RenewTime != nil && lease.Spec.LeaseDurationSeconds != nil {
+		current.ExpiresAt = lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	}
+	return &current
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var leaseNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func testLease(holder string, renewed time.Time) *coordinationv1.Lease {
+	seconds := int32(600)
+	acquired := metav1.NewMicroTime(leaseNow.Add(-time.Hour))
+	renewTime := metav1.NewMicroTime(renewed)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "usi-deploy-api-dev", Namespace: "user-jdoe"},
+		Spec: coordinationv1.LeaseSpec{HolderIdentity: &holder, LeaseDurationSeconds: &seconds,
+			AcquireTime: &acquired, RenewTime: &renewTime},
+	}
+}
+
+func TestKubernetesLeasesAcquire(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  *coordinationv1.Lease
+		force     bool
+		wantErr   bool
+		wantSince time.Time
+		// wantHolder is the holder stored in the cluster afterwards
+		wantHolder string
+	}{
+		{name: "free", wantSince: leaseNow, wantHolder: "jdoe@laptop"},
+		{name: "renewed by its holder", existing: testLease("jdoe@laptop", leaseNow.Add(-time.Minute)),
+			wantSince: leaseNow.Add(-time.Hour), wantHolder: "jdoe@laptop"},
+		{name: "held by someone else", existing: testLease("asmith@runner (remote)", leaseNow.Add(-time.Minute)),
+			wantErr: true, wantSince: leaseNow.Add(-time.Hour), wantHolder: "asmith@runner (remote)"},
+		{name: "taken over with force", existing: testLease("asmith@runner (remote)", leaseNow.Add(-time.Minute)), force: true,
+			wantSince: leaseNow, wantHolder: "jdoe@laptop"},
+		{name: "expired", existing: testLease("asmith@runner (remote)", leaseNow.Add(-time.Hour)),
+			wantSince: leaseNow, wantHolder: "jdoe@laptop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.existing != nil {
+				objects = append(objects, tt.existing)
+			}
+			client := fake.NewSimpleClientset(objects...)
+			leases := &KubernetesLeases{Client: client, Namespace: "user-jdoe", Now: func() time.Time { return leaseNow }}
+
+			lease, err := leases.AcquireLease(LeaseRequest{Deployment: "api-dev", Holder: "jdoe@laptop", TTL: 30 * time.Minute, Force: tt.force})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AcquireLease() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if lease.Holder != tt.wantHolder || !lease.Since.Equal(tt.wantSince) {
+				t.Errorf("AcquireLease() = %+v, want held by %s since %v", lease, tt.wantHolder, tt.wantSince)
+			}
+			stored, err := client.CoordinationV1().Leases("user-jdoe").Get(context.Background(), "usi-deploy-api-dev", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if holder := leaseOf(stored).Holder; holder != tt.wantHolder {
+				t.Errorf("stored lease is held by %s, want %s", holder, tt.wantHolder)
+			}
+		})
+	}
+}
+
+func TestKubernetesLeasesRelease(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    *coordinationv1.Lease
+		wantDeleted bool
+	}{
+		{name: "held", existing: testLease("jdoe@laptop", leaseNow), wantDeleted: true},
+		{name: "taken over", existing: testLease("asmith@runner (remote)", leaseNow)},
+		{name: "already gone", wantDeleted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.existing != nil {
+				objects = append(objects, tt.existing)
+			}
+			client := fake.NewSimpleClientset(objects...)
+			leases := &KubernetesLeases{Client: client, Namespace: "user-jdoe"}
+			if err := leases.ReleaseLease(LeaseRequest{Deployment: "api-dev", Holder: "jdoe@laptop"}); err != nil {
+				t.Fatalf("ReleaseLease() error = %v", err)
+			}
+			_, err := client.CoordinationV1().Leases("user-jdoe").Get(context.Background(), "usi-deploy-api-dev", metav1.GetOptions{})
+			if deleted := err != nil; deleted != tt.wantDeleted {
+				t.Errorf("deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestLeaseName(t *testing.T) {
+	tests := map[string]string{
+		"api-dev":              "usi-deploy-api-dev",
+		"api.feature-user-dev": "usi-deploy-api.feature-user-dev",
+		"API_v2:dev":           "usi-deploy-api-v2-dev",
+	}
+	for deploymentName, want := range tests {
+		if got := LeaseName(deploymentName); got != want {
+			t.Errorf("LeaseName(%q) = %q, want %q", deploymentName, got, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"platform-go-common/pkg/errors"
+
+	"usi/pkg/core"
+	"usi/pkg/type/deployment"
+)
+
+const DefaultLockTTL = 30 * time.Minute
+
+// LeaseRequest asks for the lease on a single deployment, by its full name. Force takes over a
+// lease held by someone else.
+type LeaseRequest struct {
+	Deployment string
+	Holder     string
+	TTL        time.Duration
+	Force      bool
+}
+
+// Lease is the current holder of a deployment's lease.
+type Lease struct {
+	Holder    string
+	Since     time.Time
+	ExpiresAt time.Time
+}
+
+// LeaseClient takes and gives back deployment leases. AcquireLease renews a lease the holder
+// already has and returns the current lease along with the error when someone else holds it.
+type LeaseClient interface {
+	AcquireLease(request LeaseRequest) (*Lease, error)
+	ReleaseLease(request LeaseRequest) error
+}
+
+// DeployLock is a lease on a single deployment, held while it is deployed, redeployed, rolled back
+// or undeployed.
+// The lease is renewed in the background and expires after its TTL when usi exits without
+// releasing it, e.g. on a crash. Errors while the lock is held go through Check or CheckResolve so
+// the lock is released before usi exits.
+type DeployLock struct {
+	leases  LeaseClient
+	request LeaseRequest
+	stop    chan struct{}
+	done    chan struct{}
+	release sync.Once
+}
+
+// LockHolder identifies who holds a lock, e.g. jdoe@laptop or jdoe@runner (remote).
+func LockHolder() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	holder := name + "@" + host
+	if os.Getenv("REMOTE_DEPLOY") == "true" {
+		holder += " (remote)"
+	}
+	return holder
+}
+
+func ParseLockTTL(ttl *string, command string) time.Duration {
+	if ttl == nil || *ttl == "" {
+		return DefaultLockTTL
+	}
+	d, err := time.ParseDuration(*ttl)
+	if err != nil || d <= 0 {
+		HandleError(errors.WithCode(fmt.Sprintf("invalid lock ttl (%s), use a duration such as 45m", *ttl), errors.BadRequest), command)
+	}
+	return d
+}
+
+// AcquireDeployLock takes the lock on a deployment or exits when someone else holds it. With force
+// a lock held by someone else is taken over.
+func AcquireDeployLock(command, environmentName, name, selectorString string, ttl time.Duration, force bool) *DeployLock {
+	serviceName, serviceSelector := core.ParseSelectorNameAndAddCliSelector(name, selectorString) // already normalizes
+	return AcquireDeploymentLock(command, environmentName, *deployment.Name(environmentName, serviceName, serviceSelector), ttl, force)
+}
+
+// AcquireDeploymentLock is AcquireDeployLock for a full deployment name, e.g. one read from the registry.
+// When the leases of the environment can't be reached it exits, unless force is set; it then returns
+// a nil lock, which is safe to use.
+func AcquireDeploymentLock(command, environmentName, deploymentName string, ttl time.Duration, force bool) *DeployLock {
+	leases, err := DeployLeases(command, environmentName)
+	if err != nil {
+		unreachable := fmt.Sprintf("Unable to take the deploy lock on %s: %s", deploymentName, err.Error())
+		if !force {
+			HandleError(errors.WithCode(unreachable+", use --force to continue without it", errors.BadRequest), command)
+		}
+		PrintWarning(unreachable + ", continuing without it (--force)")
+		return nil
+	}
+	var request LeaseRequest
+	request.Deployment = deploymentName
+	request.Holder = LockHolder()
+	request.TTL = ttl
+	lease, err := leases.AcquireLease(request)
+	if err != nil && lease != nil && lease.Holder != request.Holder {
+		held := fmt.Sprintf("%s is locked by %s since %s (expires %s)", deploymentName, lease.Holder,
+			ConvertDateToLocalTZ(lease.Since).Format(time.RFC1123), ConvertDateToLocalTZ(lease.ExpiresAt).Format(time.Kitchen))
+		if !force {
+			HandleError(errors.WithCode(held+", use --force to take over the lock", errors.BadRequest), command)
+		}
+		PrintWarning(held + ", taking over the lock (--force)")
+		request.Force = true
+		_, err = leases.AcquireLease(request)
+	}
+	HandleError(err, command)
+
+	lock := &DeployLock{leases: leases, request: request, stop: make(chan struct{}), done: make(chan struct{})}
+	go lock.renew(ttl)
+	return lock
+}
+
+func (l *DeployLock) renew(ttl time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	request := l.request
+	request.Force = false
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if _, err := l.leases.AcquireLease(request); err != nil {
+				PrintWarning(fmt.Sprintf("Unable to renew deploy lock: %s", err.Error()))
+			}
+		}
+	}
+}
+
+// Release stops renewing the lease and gives it back. Releasing a nil or released lock does nothing.
+func (l *DeployLock) Release() {
+	if l == nil {
+		return
+	}
+	l.release.Do(func() {
+		close(l.stop)
+		<-l.done
+		if err := l.leases.ReleaseLease(l.request); err != nil {
+			PrintWarning(fmt.Sprintf("Unable to release deploy lock, it expires after %v: %s", l.request.TTL, err.Error()))
+		}
+	})
+}
+
+// Check releases the lock before HandleError exits on err.
+func (l *DeployLock) Check(err error, command string) {
+	if err != nil {
+		l.Release()
+	}
+	HandleError(err, command)
+}
+
+// CheckResolve releases the lock before HandleResolveError exits on err.
+func (l *DeployLock) CheckResolve(command string, err error) {
+	if err != nil {
+		l.Release()
+	}
+	HandleResolveError(command, err)
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeLeases struct {
+	mu       sync.Mutex
+	acquired int
+	released int
+}
+
+func (f *fakeLeases) AcquireLease(request LeaseRequest) (*Lease, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.acquired++
+	return &Lease{Holder: request.Holder, Since: time.Now(), ExpiresAt: time.Now().Add(request.TTL)}, nil
+}
+
+func (f *fakeLeases) ReleaseLease(_ LeaseRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released++
+	return nil
+}
+
+func heldLock(leases LeaseClient, ttl time.Duration) *DeployLock {
+	lock := &DeployLock{leases: leases, request: LeaseRequest{Holder: "jdoe@laptop", TTL: ttl},
+		stop: make(chan struct{}), done: make(chan struct{})}
+	go lock.renew(ttl)
+	return lock
+}
+
+func TestDeployLockRelease(t *testing.T) {
+	tests := []struct {
+		name     string
+		use      func(lock *DeployLock)
+		ttl      time.Duration
+		renewed  bool
+		released int
+	}{
+		{name: "release", use: func(lock *DeployLock) { lock.Release() }, ttl: time.Hour, released: 1},
+		{name: "release twice", use: func(lock *DeployLock) { lock.Release(); lock.Release() }, ttl: time.Hour, released: 1},
+		{name: "check without error keeps the lock", use: func(lock *DeployLock) { lock.Check(nil, "deploy") }, ttl: time.Hour},
+		{name: "renewed while held", use: func(lock *DeployLock) { time.Sleep(50 * time.Millisecond); lock.Release() },
+			ttl: 30 * time.Millisecond, renewed: true, released: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leases := &fakeLeases{}
+			tt.use(heldLock(leases, tt.ttl))
+			leases.mu.Lock()
+			defer leases.mu.Unlock()
+			if leases.released != tt.released {
+				t.Errorf("released %d times, want %d", leases.released, tt.released)
+			}
+			if (leases.acquired > 0) != tt.renewed {
+				t.Errorf("renewed %d times, want renewed %v", leases.acquired, tt.renewed)
+			}
+		})
+	}
+}
+
+func TestNilDeployLock(t *testing.T) {
+	var lock *DeployLock
+	lock.Release()
+	lock.Check(nil, "deploy")
+	lock.CheckResolve("deploy", nil)
+}
+
+func TestAcquireDeploymentLock(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	leases := &KubernetesLeases{Client: client, Namespace: "user-jdoe"}
+	defer func(original func(string, string) (LeaseClient, error)) { DeployLeases = original }(DeployLeases)
+	DeployLeases = func(_, environmentName string) (LeaseClient, error) {
+		if environmentName != "dev" {
+			t.Errorf("DeployLeases() environment = %q, want dev", environmentName)
+		}
+		return leases, nil
+	}
+
+	lock := AcquireDeploymentLock("deploy", "dev", "api-dev", time.Minute, false)
+	lease, err := client.CoordinationV1().Leases("user-jdoe").Get(context.Background(), "usi-deploy-api-dev", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("the lease wasn't created: %v", err)
+	}
+	if *lease.Spec.HolderIdentity != LockHolder() || *lease.Spec.LeaseDurationSeconds != 60 {
+		t.Errorf("lease = %+v, want held by %s for 60s", lease.Spec, LockHolder())
+	}
+	lock.Release()
+	if _, err := client.CoordinationV1().Leases("user-jdoe").Get(context.Background(), "usi-deploy-api-dev", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("the lease is still there after Release, error = %v", err)
+	}
+}
+
+func TestAcquireDeploymentLockForcedWithoutLeases(t *testing.T) {
+	defer func(original func(string, string) (LeaseClient, error)) { DeployLeases = original }(DeployLeases)
+	DeployLeases = func(_, _ string) (LeaseClient, error) {
+		return nil, errors.New("the environment has no kubernetes cluster")
+	}
+	if lock := AcquireDeploymentLock("deploy", "dev", "api-dev", time.Minute, true); lock != nil {
+		t.Errorf("AcquireDeploymentLock() = %v, want nil when the leases can't be reached", lock)
+	}
+}
@@ -14,6 +14,7 @@ type Opts struct {
 	Annotations        *[]string
 	Dir                *string
 	Environment        *string
+	EnvironmentSet     *bool
 	Filter             *string
 	Includes           *string
 	Key                *string
@@ -48,6 +49,17 @@ type Opts struct {
 	DeployerUser       *string
 	Cluster            *string
 	Global             *bool
+	Stack              *string
+	Parallel           *int
+	Plan               *bool
+	Output             *string
+	LockTTL            *string
+	Canary             *bool
+	Verify             *string
+	Timeout            *string
+	Receipt            *string
+	Yes                *bool
+	HTTPReady          *bool
 }
 
 func NewOpts(cmd *cli.Cmd) *Opts {
@@ -69,7 +81,13 @@ func (o *Opts) DirOpt() *string {
 }
 
 func (o *Opts) EnvironmentOpt() *string {
-	o.Environment = o.cmd.StringOpt("e environment", *DefaultEnvironment(), "specify environment to work with")
+	o.EnvironmentSet = new(bool)
+	o.Environment = o.cmd.String(cli.StringOpt{
+		Name:      "e environment",
+		Value:     *DefaultEnvironment(),
+		Desc:      "specify environment to work with",
+		SetByUser: o.EnvironmentSet,
+	})
 	Reporter.UsedOption("environment", o.Environment)
 	return o.Environment
 }
@@ -189,7 +207,7 @@ func (o *Opts) ShellEscapeOpt() *bool {
 }
 
 func (o *Opts) ForceOpt() *bool {
-	o.Force = o.cmd.BoolOpt("force", false, "skip undeploy validation; requires client authentication")
+	o.Force = o.cmd.BoolOpt("force", false, "skip undeploy validation and take over another user's deploy lock; requires client authentication")
 	Reporter.UsedOption("force", o.Force)
 	return o.Force
 }
@@ -356,6 +374,72 @@ func (o *Opts) GlobalOpt() *bool {
 	return o.Global
 }
 
+func (o *Opts) StackOpt() *string {
+	o.Stack = o.cmd.StringOpt("stack", "", "yaml file listing services to deploy together, ordered by their dependencies")
+	Reporter.UsedOption("stack", o.Stack)
+	return o.Stack
+}
+
+func (o *Opts) ParallelOpt() *int {
+	o.Parallel = o.cmd.IntOpt("parallel", 4, "max services to deploy at once when deploying several services")
+	Reporter.UsedOption("parallel", o.Parallel)
+	return o.Parallel
+}
+
+func (o *Opts) PlanOpt() *bool {
+	o.Plan = o.cmd.BoolOpt("plan", false, "dry-run the deploy and show what would change; exits with 2 when there are changes")
+	Reporter.UsedOption("plan", o.Plan)
+	return o.Plan
+}
+
+func (o *Opts) OutputOpt() *string {
+	o.Output = o.cmd.StringOpt("output", OutputText, "output format: text, or json for newline delimited deploy events on stdout")
+	Reporter.UsedOption("output", o.Output)
+	return o.Output
+}
+
+func (o *Opts) LockTTLOpt() *string {
+	o.LockTTL = o.cmd.StringOpt("lock-ttl", DefaultLockTTL.String(), "how long the deploy lock is held if usi exits without releasing it")
+	Reporter.UsedOption("lock_ttl", o.LockTTL)
+	return o.LockTTL
+}
+
+func (o *Opts) CanaryOpt() *bool {
+	o.Canary = o.cmd.BoolOpt("canary", false, "deploy a canary copy under a generated selector first and promote it once it is healthy")
+	Reporter.UsedOption("canary", o.Canary)
+	return o.Canary
+}
+
+func (o *Opts) VerifyOpt() *string {
+	o.Verify = o.cmd.StringOpt("verify", "", "shell command verifying a canary, run with USI_CANARY_LINKS and USI_CANARY_NAME set")
+	Reporter.UsedOption("verify", o.Verify)
+	return o.Verify
+}
+
+func (o *Opts) TimeoutOpt() *string {
+	o.Timeout = o.cmd.StringOpt("timeout", "", "give up after this long (e.g. 20m); Ctrl-C also cancels cleanly")
+	Reporter.UsedOption("timeout", o.Timeout)
+	return o.Timeout
+}
+
+func (o *Opts) ReceiptOpt() *string {
+	o.Receipt = o.cmd.StringOpt("receipt", "", "write a JSON receipt of the deployment to this file (for CI)")
+	Reporter.UsedOption("receipt", o.Receipt)
+	return o.Receipt
+}
+
+func (o *Opts) YesOpt() *bool {
+	o.Yes = o.cmd.BoolOpt("y yes", false, "don't ask for confirmation on non-dev environments")
+	Reporter.UsedOption("yes", o.Yes)
+	return o.Yes
+}
+
+func (o *Opts) HTTPReadyOpt() *bool {
+	o.HTTPReady = o.cmd.BoolOpt("http-ready", false, "after the rollout, wait until the deployment's links and ingress hosts answer with a healthy HTTP status")
+	Reporter.UsedOption("http_ready", o.HTTPReady)
+	return o.HTTPReady
+}
+
 type DeployOpts struct {
 	annotations        *[]string
 	dryRun             *bool
@@ -372,6 +456,10 @@ type DeployOpts struct {
 	skipProduces       *bool
 	clearAnnotations   *bool
 	force              *bool
+	lockTTL            *string
+	timeout            *string
+	yes                *bool
+	httpReady          *bool
 }
 
 func NewDeployOpts(opts *Opts) DeployOpts {
@@ -391,72 +479,100 @@ func NewDeployOpts(opts *Opts) DeployOpts {
 		skipProduces:       opts.SkipProducesOpt(),
 		clearAnnotations:   opts.ClearAnnotationsOpt(),
 		force:              opts.ForceOpt(),
+		lockTTL:            opts.LockTTLOpt(),
+		timeout:            opts.TimeoutOpt(),
+		yes:                opts.YesOpt(),
+		httpReady:          opts.HTTPReadyOpt(),
 	}
 }
 
-func (o DeployOpts) String() string {
-	res := ""
+// Args returns the deploy options as command line arguments, e.g. to run `usi deploy` in another process.
+func (o DeployOpts) Args() []string {
+	var args []string
 
 	if o.annotations != nil && len(*o.annotations) > 0 {
-		fullAnnotationString := strings.Join(*o.annotations, ",")
-		res = res + "-a=" + fullAnnotationString + " "
+		args = append(args, "-a="+strings.Join(*o.annotations, ","))
 	}
 
 	if o.dryRun != nil && *o.dryRun == true {
-		res = res + "-d" + " "
+		args = append(args, "-d")
 	}
 
 	if o.env != nil && *o.env != "" {
-		res = res + "-e=" + *o.env + " "
+		args = append(args, "-e="+*o.env)
 	}
 
 	if o.name != nil && *o.name != "" {
-		res = res + "-n=" + *o.name + " "
+		args = append(args, "-n="+*o.name)
 	}
 
 	if o.m5Dir != nil && *o.m5Dir != "" {
-		res = res + "-r=" + *o.m5Dir + " "
+		args = append(args, "-r="+*o.m5Dir)
 	}
 
 	if o.props != nil && *o.props != "" {
-		res = res + "-p=" + *o.props + " "
+		args = append(args, "-p="+*o.props)
 	}
 
 	if o.selector != nil && *o.selector != "" {
-		res = res + "-s=" + *o.selector + " "
+		args = append(args, "-s="+*o.selector)
 	}
 
 	if o.target != nil && *o.target != "" {
-		res = res + "-t=" + *o.target + " "
+		args = append(args, "-t="+*o.target)
 	}
 
 	if o.verbose != nil && *o.verbose == true {
-		res = res + "-v" + " "
+		args = append(args, "-v")
 	}
 
 	if o.wait != nil && *o.wait == true {
-		res = res + "-w" + " "
+		args = append(args, "-w")
 	}
 
 	if o.logs != nil && *o.logs == true {
-		res = res + "-l" + " "
+		args = append(args, "-l")
 	}
 
 	if o.skipPostConditions != nil && *o.skipPostConditions == true {
-		res = res + "--skip-post-conditions" + " "
+		args = append(args, "--skip-post-conditions")
 	}
 
 	if o.skipProduces != nil && *o.skipProduces == true {
-		res = res + "--skip-produces" + " "
+		args = append(args, "--skip-produces")
 	}
 
 	if o.clearAnnotations != nil && *o.clearAnnotations == true {
-		res = res + "--clear-annotations" + " "
+		args = append(args, "--clear-annotations")
 	}
 
 	if o.force != nil && *o.force == true {
-		res = res + "--force" + " "
+		args = append(args, "--force")
+	}
+
+	if o.lockTTL != nil && *o.lockTTL != "" && *o.lockTTL != DefaultLockTTL.String() {
+		args = append(args, "--lock-ttl="+*o.lockTTL)
+	}
+
+	if o.timeout != nil && *o.timeout != "" {
+		args = append(args, "--timeout="+*o.timeout)
 	}
 
+	if o.yes != nil && *o.yes == true {
+		args = append(args, "--yes")
+	}
+
+	if o.httpReady != nil && *o.httpReady == true {
+		args = append(args, "--http-ready")
+	}
+
+	return args
+}
+
+func (o DeployOpts) String() string {
+	res := ""
+	for _, arg := range o.Args() {
+		res = res + arg + " "
+	}
 	return res
 }
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"platform-go-common/pkg/errors"
+)
+
+// OutputRulesFilename holds workspace specific deploy output rules and lives next to m5.yaml, e.g.
+//
+//	rules:
+//	  gradle_task:
+//	    hook: "> Task "
+//	    pattern: '> Task (\S+)'
+//	    type: sub_step
+//	    msg: "  - Running gradle task %s"
+//	    need_timing: true
+const OutputRulesFilename = "usi-output-rules.yaml"
+
+type outputRulesFile struct {
+	Rules map[string]outputRuleSpec `yaml:"rules"`
+}
+
+type outputRuleSpec struct {
+	Hook       string            `yaml:"hook"`
+	Pattern    string            `yaml:"pattern"`
+	Type       string            `yaml:"type"`
+	Prefixes   map[string]string `yaml:"prefixes"`
+	Msg        string            `yaml:"msg"`
+	NeedTiming bool              `yaml:"need_timing"`
+}
+
+// DeployOutputRules returns the built-in deploy output rules merged with the ones defined in the
+// workspace, which is m5Dir or the current directory.
+func DeployOutputRules(m5Dir *string, command string) map[string]OutputRule {
+	dir := ""
+	if m5Dir != nil {
+		dir = *m5Dir
+	}
+	if dir == "" {
+		wd, err := os.Getwd()
+		HandleError(err, command)
+		dir = wd
+	}
+	workspaceRules, err := LoadOutputRules(filepath.Join(dir, OutputRulesFilename))
+	HandleError(err, command)
+
+	rules := make(map[string]OutputRule, len(deployOutputRules)+len(workspaceRules))
+	for name, rule := range deployOutputRules {
+		rules[name] = rule
+	}
+	for name, rule := range workspaceRules {
+		rules[name] = rule
+	}
+	return rules
+}
+
+// LoadOutputRules reads and validates an output rules file. A missing file has no rules.
+func LoadOutputRules(filename string) (map[string]OutputRule, error) {
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file outputRulesFile
+	if err := yaml.UnmarshalStrict(b, &file); err != nil {
+		return nil, errors.WithCode(fmt.Sprintf("invalid %s: %s", filename, err.Error()), errors.BadRequest)
+	}
+
+	names := make([]string, 0, len(file.Rules))
+	for name := range file.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rules := make(map[string]OutputRule, len(file.Rules))
+	var problems []string
+	for _, name := range names {
+		if _, ok := deployOutputRules[name]; ok {
+			problems = append(problems, fmt.Sprintf("%s: replaces a built-in rule, pick another name", name))
+			continue
+		}
+		rule, err := file.Rules[name].outputRule()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, err.Error()))
+			continue
+		}
+		rules[name] = rule
+	}
+	if len(problems) > 0 {
+		return nil, errors.WithCode(fmt.Sprintf("invalid %s:\n  %s", filename, strings.Join(problems, "\n  ")), errors.BadRequest)
+	}
+	return rules, nil
+}
+
+func (s outputRuleSpec) outputRule() (OutputRule, error) {
+	rule := OutputRule{
+		Hook:       s.Hook,
+		Prefixes:   s.Prefixes,
+		Msg:        s.Msg,
+		NeedTiming: s.NeedTiming,
+	}
+	if s.Hook == "" {
+		return rule, fmt.Errorf("hook is required")
+	}
+
+	needsCapture := strings.Contains(s.Msg, "%") || len(s.Prefixes) > 0
+	switch s.Type {
+	case "step":
+		rule.Type = Step
+	case "step_timing":
+		rule.Type = StepTiming
+		needsCapture = true
+	case "sub_step":
+		rule.Type = SubStep
+	case "sub_step_follower":
+		rule.Type = SubStepFollower
+	case "sub_step_timing":
+		rule.Type = SubStepTiming
+		needsCapture = true
+	case "message":
+		rule.Type = Msg
+	default:
+		return rule, fmt.Errorf("unknown type (%s), values are (step, step_timing, sub_step, sub_step_follower, sub_step_timing, message)", s.Type)
+	}
+
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return rule, fmt.Errorf("invalid pattern: %s", err.Error())
+		}
+		if needsCapture && pattern.NumSubexp() < 1 {
+			return rule, fmt.Errorf("pattern needs a capture group for the message or timing")
+		}
+		rule.Pattern = pattern
+	} else if needsCapture {
+		return rule, fmt.Errorf("pattern with a capture group is required for this type and message")
+	}
+	if s.NeedTiming && rule.Type != Step && rule.Type != SubStep {
+		return rule, fmt.Errorf("need_timing only applies to step and sub_step rules")
+	}
+	return rule, nil
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func builtInRuleName() string {
+	for name := range deployOutputRules {
+		return name
+	}
+	return ""
+}
+
+func TestLoadOutputRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		missing bool
+		want    []string
+		wantErr string
+	}{
+		{name: "missing file", missing: true},
+		{name: "valid rules", content: `
+rules:
+  gradle_task:
+    hook: "> Task "
+    pattern: '> Task (\S+)'
+    type: sub_step
+    msg: "  - Running gradle task %s"
+    need_timing: true
+  lint:
+    hook: "lint ok"
+    type: message
+`, want: []string{"gradle_task", "lint"}},
+		{name: "built-in name", content: `
+rules:
+  ` + builtInRuleName() + `:
+    hook: "x"
+    type: step
+`, wantErr: builtInRuleName() + ": replaces a built-in rule"},
+		{name: "unknown type", content: `
+rules:
+  custom:
+    hook: "x"
+    type: banner
+`, wantErr: "custom: unknown type (banner)"},
+		{name: "missing hook", content: `
+rules:
+  custom:
+    type: step
+`, wantErr: "custom: hook is required"},
+		{name: "missing capture group", content: `
+rules:
+  custom:
+    hook: "took "
+    pattern: 'took \d+s'
+    type: step_timing
+`, wantErr: "custom: pattern needs a capture group"},
+		{name: "message without pattern", content: `
+rules:
+  custom:
+    hook: "x"
+    type: step
+    msg: "via %s"
+`, wantErr: "custom: pattern with a capture group is required"},
+		{name: "need_timing on a message", content: `
+rules:
+  custom:
+    hook: "x"
+    type: message
+    need_timing: true
+`, wantErr: "custom: need_timing only applies"},
+		{name: "unknown field", content: `
+rules:
+  custom:
+    hook: "x"
+    type: step
+    color: red
+`, wantErr: "field color not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), OutputRulesFilename)
+			if !tt.missing {
+				if err := ioutil.WriteFile(filename, []byte(tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			rules, err := LoadOutputRules(filename)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadOutputRules() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadOutputRules() error = %v", err)
+			}
+			if len(rules) != len(tt.want) {
+				t.Fatalf("LoadOutputRules() = %v, want %v", rules, tt.want)
+			}
+			for _, name := range tt.want {
+				if _, ok := rules[name]; !ok {
+					t.Errorf("LoadOutputRules() is missing %s", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"usi/pkg/type/deployment"
+)
+
+// PlanChangesExitCode is returned by `deploy --plan` when the deploy would change the deployment,
+// so CI can tell "changes" apart from errors (1) and "up to date" (0).
+const PlanChangesExitCode = 2
+
+type planSection struct {
+	Name    string
+	Current interface{}
+	Planned interface{}
+	// SetByRegistry sections are filled in by the registry, e.g. the links of a dry run point at
+	// its own hosts. Their changes are shown but not counted, so they don't make every plan exit 2.
+	SetByRegistry bool
+}
+
+// PlanSummary counts field changes the way terraform does.
+type PlanSummary struct {
+	Add     int
+	Change  int
+	Destroy int
+}
+
+func (p PlanSummary) HasChanges() bool {
+	return p.Add+p.Change+p.Destroy > 0
+}
+
+func planSections(current, planned *deployment.Resource) []planSection {
+	if current == nil {
+		current = &deployment.Resource{}
+	}
+	return []planSection{
+		{"configuration", current.Data.Configuration, planned.Data.Configuration, false},
+		{"declaration", current.Data.Declaration, planned.Data.Declaration, false},
+		{"annotations", current.MetaData.Annotations, planned.MetaData.Annotations, false},
+		{"links", current.Links, planned.Links, true},
+		{"kubernetes", current.Kubernetes, planned.Kubernetes, true},
+		{"cluster", current.Cluster, planned.Cluster, true},
+	}
+}
+
+// PrintDeployPlan diffs the dry-run result of a deploy against the current deployment, which is nil
+// when the service is not deployed yet.
+func PrintDeployPlan(current, planned *deployment.Resource, command string) PlanSummary {
+	var summary PlanSummary
+	if current == nil {
+		PrintHeader("%s will be created", planned.Name)
+	} else {
+		PrintHeader("%s (%s) will be updated in-place", planned.Name, current.UUID)
+	}
+	for _, section := range planSections(current, planned) {
+		changes, err := DiffFields(section.Current, section.Planned)
+		HandleError(err, command)
+		if len(changes) == 0 {
+			continue
+		}
+		if section.SetByRegistry {
+			fmt.Printf("  ~ %s (set by registry)\n", section.Name)
+			PrintFieldChanges(os.Stdout, changes, "      ")
+			continue
+		}
+		added, removed := 0, 0
+		for _, change := range changes {
+			switch {
+			case change.Added:
+				added++
+				summary.Add++
+			case change.Removed:
+				removed++
+				summary.Destroy++
+			default:
+				summary.Change++
+			}
+		}
+		symbol := "~"
+		if added == len(changes) {
+			symbol = "+"
+		} else if removed == len(changes) {
+			symbol = "-"
+		}
+		fmt.Printf("  %s %s\n", symbol, section.Name)
+		PrintFieldChanges(os.Stdout, changes, "      ")
+	}
+
+	fmt.Println("")
+	if !summary.HasChanges() {
+		fmt.Printf("No changes. %s is up to date.\n", planned.Name)
+	} else {
+		fmt.Printf("Plan: %d to add, %d to change, %d to destroy.\n", summary.Add, summary.Change, summary.Destroy)
+	}
+	return summary
+}
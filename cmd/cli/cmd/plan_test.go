@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"usi/pkg/type/deployment"
+)
+
+// planResource builds a deployment the way the registry returns it, including the state it maintains.
+func planResource(t *testing.T, annotations map[string]string, links, cluster string) *deployment.Resource {
+	t.Helper()
+	var d deployment.Resource
+	if err := remarshal(map[string]interface{}{
+		"name":    "api",
+		"links":   map[string]string{"ui": links},
+		"cluster": map[string]string{"name": cluster},
+	}, &d); err != nil {
+		t.Fatal(err)
+	}
+	d.MetaData.Annotations = annotations
+	return &d
+}
+
+func TestPrintDeployPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		current *deployment.Resource
+		planned *deployment.Resource
+		want    PlanSummary
+	}{
+		{name: "unchanged",
+			current: planResource(t, map[string]string{"team": "core"}, "https://api.example.com", "user-a"),
+			planned: planResource(t, map[string]string{"team": "core"}, "https://api-dry-run.example.com", "user-b")},
+		{name: "annotation added",
+			current: planResource(t, map[string]string{"team": "core"}, "https://api.example.com", "user-a"),
+			planned: planResource(t, map[string]string{"team": "core", "owner": "ops"}, "https://api.example.com", "user-a"),
+			want:    PlanSummary{Add: 1}},
+		{name: "annotation changed and removed",
+			current: planResource(t, map[string]string{"team": "core", "owner": "ops"}, "https://api.example.com", "user-a"),
+			planned: planResource(t, map[string]string{"team": "web"}, "https://api.example.com", "user-a"),
+			want:    PlanSummary{Change: 1, Destroy: 1}},
+		{name: "first deploy",
+			planned: planResource(t, map[string]string{"team": "core"}, "https://api.example.com", "user-a"),
+			want:    PlanSummary{Add: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PrintDeployPlan(tt.current, tt.planned, "deploy")
+			if got != tt.want {
+				t.Errorf("PrintDeployPlan() = %+v, want %+v", got, tt.want)
+			}
+			if got.HasChanges() != (tt.want != PlanSummary{}) {
+				t.Errorf("HasChanges() = %v", got.HasChanges())
+			}
+		})
+	}
+}
+
+func TestPlanSections(t *testing.T) {
+	setByRegistry := map[string]bool{}
+	for _, section := range planSections(nil, planResource(t, nil, "https://api.example.com", "user-a")) {
+		setByRegistry[section.Name] = section.SetByRegistry
+	}
+	want := map[string]bool{"configuration": false, "declaration": false, "annotations": false,
+		"links": true, "kubernetes": true, "cluster": true}
+	if !reflect.DeepEqual(setByRegistry, want) {
+		t.Errorf("planSections() set by registry = %v, want %v", setByRegistry, want)
+	}
+}
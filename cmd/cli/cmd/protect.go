@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"platform-go-common/pkg/errors"
+
+	"usi/pkg/registry"
+	"usi/pkg/type/environment"
+)
+
+// ProtectionAnnotation on an environment raises its protection level, e.g. usi/protection=protected.
+const ProtectionAnnotation = "usi/protection"
+
+// ProtectionLevel says what deploy and undeploy require before changing an environment.
+type ProtectionLevel int
+
+const (
+	// ProtectionNone applies to dev environments, changes go ahead without asking.
+	ProtectionNone ProtectionLevel = iota
+	// ProtectionConfirm applies to every other environment, changes need a confirmation or --yes.
+	ProtectionConfirm
+	// ProtectionProtected additionally needs --force, which the registry only accepts from
+	// authenticated clients.
+	ProtectionProtected
+)
+
+var protectionLevels = map[string]ProtectionLevel{
+	"none":      ProtectionNone,
+	"confirm":   ProtectionConfirm,
+	"protected": ProtectionProtected,
+}
+
+func (l ProtectionLevel) String() string {
+	for name, level := range protectionLevels {
+		if level == l {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// EnvironmentProtection returns the protection level of an environment from the kubernetes details
+// the registry has for it, which are nil or have no cluster for top level environments. Dev
+// environments are the ones on a user cluster, the same rule IsDevEnvironmentDeployment applies to
+// deployments, so the level doesn't depend on whether a service is already deployed. The
+// environment annotation can raise the level but never lower it.
+func EnvironmentProtection(env *environment.Resource, envK8s *registry.EnvironmentKubernetesResponse) ProtectionLevel {
+	level := ProtectionConfirm
+	if envK8s != nil && envK8s.Cluster != nil && strings.Contains(envK8s.Cluster.Name, "user") {
+		level = ProtectionNone
+	}
+	value, found := env.MetaData.Annotations[ProtectionAnnotation]
+	if !found {
+		return level
+	}
+	annotated, known := protectionLevels[strings.ToLower(strings.TrimSpace(value))]
+	if !known {
+		PrintWarning(fmt.Sprintf("Unknown %s annotation (%s) on the environment, treating it as protected", ProtectionAnnotation, value))
+		annotated = ProtectionProtected
+	}
+	if annotated > level {
+		return annotated
+	}
+	return level
+}
+
+// ConfirmAction prints what is about to change and asks for confirmation, unless the level is
+// ProtectionNone or yes is set. Protected environments require force and, when asked
+// interactively, the environment name typed back. Exits when the action is not confirmed.
+func ConfirmAction(command string, level ProtectionLevel, environmentName string, summary []string, yes, force bool) {
+	if level == ProtectionNone {
+		return
+	}
+	if level == ProtectionProtected && !force {
+		HandleError(errors.WithCode(fmt.Sprintf("environment %s is protected, %s requires --force (client authentication)", environmentName, command), errors.BadRequest), command)
+	}
+
+	PrintHeader("%s on %s environment %s", command, level, environmentName)
+	for _, line := range summary {
+		fmt.Printf("  %s\n", line)
+	}
+	fmt.Printf("  Requester: %s\n", LockHolder())
+	fmt.Println("")
+	if yes {
+		return
+	}
+
+	if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		HandleError(errors.WithCode(fmt.Sprintf("%s on environment %s must be confirmed, pass --yes when not running interactively", command, environmentName), errors.BadRequest), command)
+	}
+	if level == ProtectionProtected {
+		fmt.Fprintf(os.Stderr, "Type the environment name (%s) to continue: ", environmentName)
+	} else {
+		fmt.Fprint(os.Stderr, "Continue? [y/N]: ")
+	}
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if level == ProtectionProtected && answer == environmentName {
+		return
+	}
+	if level != ProtectionProtected && (strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")) {
+		return
+	}
+	Reporter.SendHoneycombEvent(command, map[string]interface{}{
+		"environment": environmentName,
+		"protection":  level.String(),
+		"result":      "not_confirmed",
+	})
+	HandleError(errors.WithCode(fmt.Sprintf("%s not confirmed", command), errors.BadRequest), command)
+}
+
+// ConfirmEnvironmentChange is ConfirmAction at the protection level of environmentName. Every
+// command that changes the deployments of an environment goes through it.
+func ConfirmEnvironmentChange(command, environmentName string, env *environment.Resource, summary []string, yes, force bool) {
+	level := EnvironmentProtection(env, GetEnvironmentKubernetes(command, environmentName))
+	ConfirmAction(command, level, environmentName, summary, yes, force)
+}
+
+// ConfirmDeploy guards deploying services to deployOpts.env. Once confirmed, deployOpts.yes is set
+// so `usi deploy` processes started for the services don't ask again.
+func ConfirmDeploy(command string, deployOpts DeployOpts, env *environment.Resource, services []string) {
+	if *deployOpts.dryRun {
+		return
+	}
+	summary := []string{"Services:  " + strings.Join(services, ", ")}
+	if *deployOpts.selector != "" {
+		summary = append(summary, "Selector:  "+*deployOpts.selector)
+	}
+	if *deployOpts.target != "" {
+		summary = append(summary, "Target:    "+*deployOpts.target)
+	}
+	if *deployOpts.force {
+		summary = append(summary, "Force:     true")
+	}
+	ConfirmEnvironmentChange(command, *deployOpts.env, env, summary, *deployOpts.yes, *deployOpts.force)
+	*deployOpts.yes = true
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"usi/pkg/registry"
+	"usi/pkg/type/environment"
+)
+
+// environmentKubernetesFixture is what the registry returns for the kubernetes details of a dev environment.
+const environmentKubernetesFixture = `{
+  "cluster": {"clusterId": "c-m-7x2kq", "name": "user-east-1", "region": "us-east-1"},
+  "namespace": {"namespace": {"name": "user-jdoe"}}
+}`
+
+func TestEnvironmentProtection(t *testing.T) {
+	var devKubernetes registry.EnvironmentKubernetesResponse
+	if err := json.Unmarshal([]byte(environmentKubernetesFixture), &devKubernetes); err != nil {
+		t.Fatal(err)
+	}
+	var sharedKubernetes registry.EnvironmentKubernetesResponse
+	if err := remarshal(&devKubernetes, &sharedKubernetes); err != nil {
+		t.Fatal(err)
+	}
+	sharedKubernetes.Cluster.Name = "shared-east-1"
+
+	tests := []struct {
+		name        string
+		kubernetes  *registry.EnvironmentKubernetesResponse
+		annotations map[string]interface{}
+		want        ProtectionLevel
+	}{
+		{name: "user cluster without deployments", kubernetes: &devKubernetes, want: ProtectionNone},
+		{name: "shared cluster", kubernetes: &sharedKubernetes, want: ProtectionConfirm},
+		{name: "top level environment", want: ProtectionConfirm},
+		{name: "top level environment without a cluster", kubernetes: &registry.EnvironmentKubernetesResponse{}, want: ProtectionConfirm},
+		{name: "annotation raises a dev environment", kubernetes: &devKubernetes,
+			annotations: map[string]interface{}{ProtectionAnnotation: "confirm"}, want: ProtectionConfirm},
+		{name: "protected", kubernetes: &sharedKubernetes,
+			annotations: map[string]interface{}{ProtectionAnnotation: " Protected "}, want: ProtectionProtected},
+		{name: "annotation never lowers", kubernetes: &sharedKubernetes,
+			annotations: map[string]interface{}{ProtectionAnnotation: "none"}, want: ProtectionConfirm},
+		{name: "unknown annotation is protected", kubernetes: &devKubernetes,
+			annotations: map[string]interface{}{ProtectionAnnotation: "locked"}, want: ProtectionProtected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "dev", "annotations": tt.annotations},
+			}
+			var env environment.Resource
+			if err := remarshal(stored, &env); err != nil {
+				t.Fatal(err)
+			}
+			if got := EnvironmentProtection(&env, tt.kubernetes); got != tt.want {
+				t.Errorf("EnvironmentProtection() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"usi/pkg/type/deployment"
+)
+
+const (
+	// ExitCodeRolloutFailed is returned by wait when the rollout fails, e.g. its progress deadline passed.
+	ExitCodeRolloutFailed = 3
+	// ExitCodeUnhealthy is returned by wait --http-ready when an endpoint doesn't become healthy.
+	ExitCodeUnhealthy = 4
+	// ExitCodeCannotWait is returned by wait when it can't follow the rollout, e.g. the cluster
+	// rejects the credentials or the workload kind isn't supported, so nothing is known about it.
+	ExitCodeCannotWait = 5
+)
+
+const (
+	// defaultReadinessTimeout bounds how long endpoints may stay unhealthy when there is no
+	// --timeout. With one, the endpoints are polled until it passes and it exits with ExitCodeTimeout.
+	defaultReadinessTimeout = 5 * time.Minute
+	readinessInterval       = 5 * time.Second
+)
+
+// ReadinessURLs returns the http(s) links of a deployment and its ingress hosts, the ones
+// PrintLinks and PrintIngressHostsIfAvailable show. Hosts covered by an ingress tls section are
+// checked over https, the others over http. Wildcard hosts are skipped, there is no single url
+// to check for them.
+func ReadinessURLs(d *deployment.Resource, command string) []string {
+	seen := map[string]bool{}
+	add := func(u string) {
+		u = strings.TrimSpace(u)
+		if u != "" {
+			seen[u] = true
+		}
+	}
+
+	links, err := FlattenFields(d.Links)
+	HandleError(err, command)
+	for _, value := range links {
+		if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+			add(value)
+		}
+	}
+
+	k8sFields, err := FlattenFields(d.Kubernetes)
+	HandleError(err, command)
+	var hosts, tlsHosts []string
+	for field, value := range k8sFields {
+		last := strings.ToLower(path.Ext("." + field))
+		if i := strings.Index(last, "["); i >= 0 {
+			last = last[:i]
+		}
+		switch {
+		case strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://"):
+			add(value)
+		case last != ".host" && last != ".hosts":
+		case strings.HasPrefix(field, "tls[") || strings.Contains(field, ".tls["):
+			tlsHosts = append(tlsHosts, strings.TrimSpace(value))
+		default:
+			hosts = append(hosts, strings.TrimSpace(value))
+		}
+	}
+	for _, host := range hosts {
+		if strings.HasPrefix(host, "*") {
+			continue
+		}
+		scheme := "http://"
+		for _, tlsHost := range tlsHosts {
+			if tlsCovers(tlsHost, host) {
+				scheme = "https://"
+				break
+			}
+		}
+		add(scheme + host)
+	}
+
+	urls := make([]string, 0, len(seen))
+	for u := range seen {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// tlsCovers tells whether a host of an ingress tls section, possibly a wildcard, covers host.
+func tlsCovers(tlsHost, host string) bool {
+	if strings.EqualFold(tlsHost, host) {
+		return true
+	}
+	if !strings.HasPrefix(tlsHost, "*.") {
+		return false
+	}
+	i := strings.Index(host, ".")
+	return i > 0 && strings.EqualFold(host[i:], tlsHost[1:])
+}
+
+// WaitForEndpoints polls every url until it answers with a 2xx or 3xx status. Redirects aren't
+// followed, so a redirect to a login page counts as healthy. It returns the urls still unhealthy
+// with their last error when ctx is done, or after defaultReadinessTimeout when ctx has no deadline. Progress is called when an
+// endpoint's status changes, an empty status meaning healthy; nil prints it.
+func WaitForEndpoints(ctx context.Context, urls []string, progress func(u, status string)) map[string]string {
+	if progress == nil {
+		progress = func(u, status string) {
+			if status == "" {
+				fmt.Printf("  %s is healthy\n", u)
+			} else {
+				fmt.Printf("  %s: %s\n", u, status)
+			}
+		}
+	}
+	readyCtx, cancel := context.WithCancel(ctx)
+	if _, ok := ctx.Deadline(); !ok {
+		readyCtx, cancel = context.WithTimeout(ctx, defaultReadinessTimeout)
+	}
+	defer cancel()
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	unhealthy := make(map[string]string, len(urls))
+	for _, u := range urls {
+		unhealthy[u] = "not checked"
+	}
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+	for {
+		for u := range unhealthy {
+			status := checkEndpoint(readyCtx, client, u)
+			if status == "" {
+				progress(u, status)
+				delete(unhealthy, u)
+			} else if status != unhealthy[u] {
+				progress(u, status)
+				unhealthy[u] = status
+			}
+		}
+		if len(unhealthy) == 0 {
+			return unhealthy
+		}
+		select {
+		case <-readyCtx.Done():
+			return unhealthy
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkEndpoint returns why u is unhealthy, or an empty string.
+func checkEndpoint(ctx context.Context, client *http.Client, u string) string {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err.Error()
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err.Error()
+	}
+	_ = response.Body.Close()
+	if response.StatusCode >= 400 {
+		return response.Status
+	}
+	return ""
+}
+
+// WaitForDeploymentReady waits for the endpoints of a rolled out deployment and exits with
+// ExitCodeUnhealthy when one of them stays unhealthy.
+func WaitForDeploymentReady(ctx context.Context, d *deployment.Resource, command string) time.Duration {
+	start := time.Now()
+	urls := ReadinessURLs(d, command)
+	if len(urls) == 0 {
+		PrintWarning("The deployment has no links or ingress hosts to check, skipping --http-ready")
+		return time.Since(start)
+	}
+	PrintHeader("Waiting for %d endpoints of %s to become healthy ...", len(urls), d.Name)
+	unhealthy := WaitForEndpoints(ctx, urls, nil)
+	if len(unhealthy) == 0 {
+		return time.Since(start)
+	}
+	if ctx.Err() != nil {
+		// a --timeout or Ctrl-C is reported by the Operation
+		PrintWarning(fmt.Sprintf("%s endpoints were still unhealthy: %s", d.Name, UnhealthyEndpoints(unhealthy)))
+		return time.Since(start)
+	}
+
+	ExitWithCode(command, ExitCodeUnhealthy, fmt.Sprintf("%s endpoints are unhealthy after %s: %s",
+		d.Name, time.Since(start).Round(time.Second), UnhealthyEndpoints(unhealthy)), map[string]interface{}{
+		"service_name": d.Name,
+		"result":       "unhealthy",
+	})
+	return time.Since(start)
+}
+
+// UnhealthyEndpoints lists the endpoints returned by WaitForEndpoints with their last error.
+func UnhealthyEndpoints(unhealthy map[string]string) string {
+	failed := make([]string, 0, len(unhealthy))
+	for u, status := range unhealthy {
+		failed = append(failed, fmt.Sprintf("%s (%s)", u, status))
+	}
+	sort.Strings(failed)
+	return strings.Join(failed, ", ")
+}
+
+// ExitWithCode reports a failure that scripts need to tell apart from other errors and exits
+// with code instead of going through HandleError.
+func ExitWithCode(command string, code int, message string, fields map[string]interface{}) {
+	_, _ = fmt.Fprintf(os.Stderr, "Error: %s\n", message)
+	fields["exit_code"] = code
+	fields["error"] = message
+	Reporter.SendHoneycombEvent(command, fields)
+	Reporter.Close()
+	os.Exit(code)
+}
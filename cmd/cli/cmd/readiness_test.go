@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"usi/pkg/type/deployment"
+)
+
+func TestReadinessURLs(t *testing.T) {
+	tests := []struct {
+		name       string
+		links      interface{}
+		kubernetes interface{}
+		want       []string
+	}{
+		{name: "links", links: map[string]interface{}{"docs": "https://docs.example.com", "repo": "git@example.com:api.git"},
+			want: []string{"https://docs.example.com"}},
+		{name: "ingress without tls", kubernetes: map[string]interface{}{"ingress": map[string]interface{}{"spec": map[string]interface{}{
+			"rules": []interface{}{map[string]interface{}{"host": "api.user.example.com"}},
+		}}}, want: []string{"http://api.user.example.com"}},
+		{name: "ingress with tls", kubernetes: map[string]interface{}{"ingress": map[string]interface{}{"spec": map[string]interface{}{
+			"rules": []interface{}{map[string]interface{}{"host": "api.user.example.com"}, map[string]interface{}{"host": "api.internal"}},
+			"tls":   []interface{}{map[string]interface{}{"hosts": []interface{}{"api.user.example.com"}}},
+		}}}, want: []string{"http://api.internal", "https://api.user.example.com"}},
+		{name: "wildcard tls certificate", kubernetes: map[string]interface{}{"ingress": map[string]interface{}{"spec": map[string]interface{}{
+			"rules": []interface{}{map[string]interface{}{"host": "api.user.example.com"}},
+			"tls":   []interface{}{map[string]interface{}{"hosts": []interface{}{"*.user.example.com"}}},
+		}}}, want: []string{"https://api.user.example.com"}},
+		{name: "wildcard hosts are skipped", kubernetes: map[string]interface{}{"ingress": map[string]interface{}{"spec": map[string]interface{}{
+			"rules": []interface{}{map[string]interface{}{"host": "*.user.example.com"}},
+			"tls":   []interface{}{map[string]interface{}{"hosts": []interface{}{"*.user.example.com"}}},
+		}}}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d deployment.Resource
+			if err := remarshal(map[string]interface{}{"name": "api-dev", "links": tt.links, "kubernetes": tt.kubernetes}, &d); err != nil {
+				t.Fatal(err)
+			}
+			if got := ReadinessURLs(&d, "wait"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadinessURLs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTLSCovers(t *testing.T) {
+	tests := []struct {
+		tlsHost, host string
+		want          bool
+	}{
+		{tlsHost: "api.example.com", host: "api.example.com", want: true},
+		{tlsHost: "API.example.com", host: "api.example.com", want: true},
+		{tlsHost: "*.example.com", host: "api.example.com", want: true},
+		{tlsHost: "*.example.com", host: "v1.api.example.com"},
+		{tlsHost: "*.example.com", host: "example.com"},
+		{tlsHost: "web.example.com", host: "api.example.com"},
+	}
+	for _, tt := range tests {
+		if got := tlsCovers(tt.tlsHost, tt.host); got != tt.want {
+			t.Errorf("tlsCovers(%q, %q) = %v, want %v", tt.tlsHost, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestWaitForEndpoints(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	tests := []struct {
+		name    string
+		urls    []string
+		timeout time.Duration
+		want    []string
+	}{
+		{name: "healthy", urls: []string{healthy.URL}, timeout: time.Minute, want: []string{}},
+		{name: "unhealthy until the deadline", urls: []string{healthy.URL, failing.URL}, timeout: 200 * time.Millisecond,
+			want: []string{failing.URL}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			start := time.Now()
+			unhealthy := WaitForEndpoints(ctx, tt.urls, func(string, string) {})
+			got := make([]string, 0, len(unhealthy))
+			for u := range unhealthy {
+				got = append(got, u)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WaitForEndpoints() = %v, want %v", unhealthy, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > tt.timeout+time.Second {
+				t.Errorf("WaitForEndpoints() took %v, past the %v deadline", elapsed, tt.timeout)
+			}
+		})
+	}
+}
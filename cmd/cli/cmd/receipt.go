@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"usi/pkg/type/deployment"
+)
+
+// ReceiptVersion is bumped whenever a field of DeployReceipt changes meaning or is removed.
+// New fields may be added without a bump.
+const ReceiptVersion = 1
+
+// DeployReceipt is written by `deploy --receipt` for CI jobs that need the outcome of a deploy.
+type DeployReceipt struct {
+	Version             int                  `json:"version"`
+	CreatedAt           time.Time            `json:"created_at"`
+	Name                string               `json:"name"`
+	UUID                interface{}          `json:"uuid"`
+	Environment         string               `json:"environment"`
+	Selector            string               `json:"selector,omitempty"`
+	Target              string               `json:"target,omitempty"`
+	DryRun              bool                 `json:"dry_run"`
+	Links               interface{}          `json:"links,omitempty"`
+	Kubernetes          interface{}          `json:"kubernetes,omitempty"`
+	ProducedKeys        interface{}          `json:"produced_keys,omitempty"`
+	Warnings            []string             `json:"warnings"`
+	ScriptTimesS        map[string]float64   `json:"script_times_s"`
+	DeploymentDurationS float64              `json:"deployment_duration_s"`
+	WaitDurationS       *float64             `json:"wait_duration_s,omitempty"`
+	Deployment          *deployment.Resource `json:"deployment"`
+}
+
+func NewDeployReceipt(d *deployment.Resource, environment, selector, target string, dryRun bool) *DeployReceipt {
+	return &DeployReceipt{
+		Version:      ReceiptVersion,
+		CreatedAt:    time.Now().UTC(),
+		Name:         d.Name,
+		UUID:         d.UUID,
+		Environment:  environment,
+		Selector:     selector,
+		Target:       target,
+		DryRun:       dryRun,
+		Links:        d.Links,
+		Kubernetes:   d.Kubernetes,
+		Warnings:     []string{},
+		ScriptTimesS: map[string]float64{},
+		Deployment:   d,
+	}
+}
+
+// Write replaces filename atomically, so a CI job never reads a half written receipt.
+func (r *DeployReceipt) Write(filename string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".receipt-*")
+	if err != nil {
+		return err
+	}
+	defer func(name string) {
+		_ = os.Remove(name)
+	}(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
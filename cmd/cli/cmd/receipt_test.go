@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"usi/pkg/type/deployment"
+)
+
+func TestDeployReceiptWrite(t *testing.T) {
+	wait := 12.5
+	tests := []struct {
+		name     string
+		dryRun   bool
+		wait     *float64
+		warnings []string
+		existing string
+		wantKeys []string
+		noKeys   []string
+	}{
+		{name: "deploy", wantKeys: []string{"version", "created_at", "name", "environment", "dry_run", "warnings", "script_times_s", "deployment"},
+			noKeys: []string{"wait_duration_s", "selector"}},
+		{name: "dry run", dryRun: true},
+		{name: "waited with warnings", wait: &wait, warnings: []string{"deprecated property"}, wantKeys: []string{"wait_duration_s"}},
+		{name: "replaces an older receipt", existing: `{"version": 0, "name": "old"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "receipt.json")
+			if tt.existing != "" {
+				if err := ioutil.WriteFile(filename, []byte(tt.existing), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			receipt := NewDeployReceipt(&deployment.Resource{Name: "api-dev"}, "dev", "", "", tt.dryRun)
+			receipt.ScriptTimesS["build.sh"] = 3.25
+			receipt.WaitDurationS = tt.wait
+			if tt.warnings != nil {
+				receipt.Warnings = tt.warnings
+			}
+			if err := receipt.Write(filename); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			b, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got DeployReceipt
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("receipt is not valid json: %v", err)
+			}
+			if got.Version != ReceiptVersion || got.Name != "api-dev" || got.Environment != "dev" || got.DryRun != tt.dryRun {
+				t.Errorf("read back %+v", got)
+			}
+			if !got.CreatedAt.Equal(receipt.CreatedAt) {
+				t.Errorf("created_at = %v, want %v", got.CreatedAt, receipt.CreatedAt)
+			}
+			if !reflect.DeepEqual(got.ScriptTimesS, receipt.ScriptTimesS) || !reflect.DeepEqual(got.Warnings, receipt.Warnings) {
+				t.Errorf("script times %v and warnings %v, want %v and %v", got.ScriptTimesS, got.Warnings, receipt.ScriptTimesS, receipt.Warnings)
+			}
+			if !reflect.DeepEqual(got.WaitDurationS, tt.wait) {
+				t.Errorf("wait_duration_s = %v, want %v", got.WaitDurationS, tt.wait)
+			}
+			if got.Deployment == nil || got.Deployment.Name != "api-dev" {
+				t.Errorf("deployment = %+v", got.Deployment)
+			}
+
+			var keys map[string]interface{}
+			if err := json.Unmarshal(b, &keys); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := keys[key]; !ok {
+					t.Errorf("receipt is missing %s", key)
+				}
+			}
+			for _, key := range tt.noKeys {
+				if _, ok := keys[key]; ok {
+					t.Errorf("receipt has %s", key)
+				}
+			}
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 {
+				t.Errorf("%d files left in the receipt directory, want only the receipt", len(files))
+			}
+		})
+	}
+}
+
+func TestDeployReceiptWriteMissingDir(t *testing.T) {
+	receipt := NewDeployReceipt(&deployment.Resource{Name: "api-dev"}, "dev", "", "", false)
+	if err := receipt.Write(filepath.Join(t.TempDir(), "missing", "receipt.json")); err == nil {
+		t.Error("Write() into a missing directory succeeded")
+	}
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+	"platform-go-common/pkg/errors"
+
+	"usi/pkg/client"
+	"usi/pkg/core"
+	"usi/pkg/type/deployment"
+	"usi/pkg/type/environment"
+)
+
+func CmdRedeploy(cmd *cli.Cmd) {
+	command := "redeploy"
+	cmd.Spec = "( -u=<uuid> | -n=<name> ) [ -e=<environment> ] [ -s=<selector> ] [ -d ] [ -w ] [ --force ] [ -y ] [ --lock-ttl=<duration> ]"
+	opts := NewOpts(cmd)
+	uuid := opts.UUIDOpt()
+	name := opts.NameOpt()
+	environmentName := opts.EnvironmentOpt()
+	selectorString := opts.SelectorOpt()
+	dryRun := opts.DryRunOpt()
+	wait := opts.WaitOpt()
+	force := opts.ForceOpt()
+	lockTTL := opts.LockTTLOpt()
+	yes := opts.YesOpt()
+
+	cmd.Action = func() {
+		opts.Normalize(command)
+		opts.Validate(command)
+		if *uuid != "" && *selectorString != "" {
+			HandleError(errors.WithCode("-s can't be combined with -u, the deployment found by UUID already has its selector", errors.BadRequest), command)
+		}
+		var environmentResource = &environment.Resource{}
+		if *name != "" {
+			environmentName = ToggleEnvironment(environmentName, name)
+			ValidateAndRetrieveEnvironment(command, environmentName).Remarshal(environmentResource)
+		}
+		current, targetEnvironment := RedeployTarget(command, *environmentName, *opts.EnvironmentSet, *uuid, *name, *selectorString)
+		if *uuid != "" {
+			environmentName = &targetEnvironment
+			ValidateAndRetrieveEnvironment(command, environmentName).Remarshal(environmentResource)
+		}
+		request := DeployRequestFromResource(current, *environmentName, command)
+		request.Force = *force
+		request.DryRun = *dryRun
+		if !request.DryRun {
+			PrintHeader("* Redeploying %s (%s) via usi", current.Name, current.UUID)
+		} else {
+			PrintHeader("* Redeploying %s (%s) via usi (Dry Run)", current.Name, current.UUID)
+		}
+
+		var lock *DeployLock
+		if !request.DryRun {
+			ConfirmEnvironmentChange(command, *environmentName, environmentResource,
+				[]string{fmt.Sprintf("Redeploy:  %s (%s)", current.Name, current.UUID)}, *yes, *force)
+			lock = AcquireDeploymentLock(command, *environmentName, current.Name, ParseLockTTL(lockTTL, command), *force)
+		}
+		deployStart := time.Now()
+		deployResponse, err := Workspace(nil, os.Stdout, os.Stderr, command).Deploy(request)
+		lock.Release()
+		HandleResolveError(command, err)
+		if request.DryRun {
+			PrintYAML(deployResponse.Deployment, command)
+		}
+		deploymentDuration := time.Since(deployStart)
+		PrintHeader("Completed Redeploy: %s (%s) in %vs", deployResponse.Deployment.Name, deployResponse.Deployment.UUID, roundFloat(deploymentDuration.Seconds(), 3))
+		if deployResponse.Warnings != nil {
+			for _, warning := range deployResponse.Warnings {
+				PrintWarning(warning)
+			}
+		}
+		HandleDeployWarning(deployResponse, command)
+
+		honeyCombMap := map[string]interface{}{
+			"environment":           environmentName,
+			"service_name":          name,
+			"uuid":                  uuid,
+			"selectors":             selectorString,
+			"dryrun":                strconv.FormatBool(*dryRun),
+			"deployment_duration_s": deploymentDuration.Seconds(),
+			"result":                "success",
+		}
+		if *wait && !request.DryRun {
+			waitDur := WaitForDeployment(deployResponse.Deployment, *environmentName, command)
+			honeyCombMap["wait_duration_s"] = waitDur.Seconds()
+		}
+		Reporter.SendHoneycombEvent(command, honeyCombMap)
+		Reporter.SendSnowflakeEvent(command, map[string]interface{}{
+			"service_name":    current.Name,
+			"additional_info": "environment:" + *environmentName + " dryrun:" + strconv.FormatBool(*dryRun),
+			"environment":     *environmentName,
+		})
+	}
+}
+
+// RedeployTarget looks up the deployment to redeploy, by UUID or by name, and returns it with the
+// environment to redeploy it to. A deployment found by UUID is redeployed to its own environment,
+// which must be environmentName only when that was passed with -e.
+func RedeployTarget(command, environmentName string, environmentSet bool, uuid, name, selectorString string) (*deployment.Resource, string) {
+	if uuid == "" {
+		serviceName, serviceSelector := core.ParseSelectorNameAndAddCliSelector(name, selectorString) // already normalizes
+		normName := core.JoinNameAndSelector(serviceName, serviceSelector)
+		AssertDeployment(command, environmentName, normName)
+		d := GetServiceDeployment(command, environmentName, *normName, nil)
+		if d == nil {
+			HandleError(errors.WithCode(fmt.Sprintf("Unable to find deployment (%s) in environment {%s}", *normName, environmentName), errors.NotFound),
+				command)
+		}
+		return d, environmentName
+	}
+
+	var resource client.Resource
+	HandleError(Workspace(nil, os.Stdout, os.Stderr, command).FromUUID(uuid, &resource), command)
+	if *resource.TypeName != deployment.TypeName {
+		HandleError(errors.WithCode(fmt.Sprintf("%s is a %s, not a deployment", uuid, *resource.TypeName), errors.BadRequest), command)
+	}
+	var d deployment.Resource
+	HandleError(resource.Remarshal(&d), command)
+	if !environmentSet {
+		own, ok := deploymentEnvironment(&d)
+		if !ok {
+			HandleError(errors.WithCode(fmt.Sprintf("unable to tell the environment of deployment %s (%s), pass it with -e", uuid, d.Name), errors.BadRequest),
+				command)
+		}
+		return &d, own
+	}
+	inEnvironment := GetServiceDeployment(command, environmentName, d.ShortName(), nil)
+	if inEnvironment == nil || fmt.Sprint(inEnvironment.UUID) != fmt.Sprint(d.UUID) {
+		HandleError(errors.WithCode(fmt.Sprintf("deployment %s is not in environment {%s}, leave out -e to redeploy it to its own environment", uuid, environmentName), errors.BadRequest),
+			command)
+	}
+	return &d, environmentName
+}
+
+// deploymentEnvironment returns the environment recorded in the request data of a stored
+// deployment, e.g. dev.feature, and false when none was recorded.
+func deploymentEnvironment(d *deployment.Resource) (string, bool) {
+	var request deployment.ClientDeployRequest
+	if err := remarshal(d.Data, &request); err != nil || request.Environment.Name == nil || *request.Environment.Name == "" {
+		return "", false
+	}
+	return *core.JoinNameAndSelector(*request.Environment.Name, request.Environment.Selector), true
+}
+
+// DeployRequestFromResource rebuilds the request that produced a stored deployment from its
+// declaration, configuration and annotations, so it can be submitted again without a workspace.
+func DeployRequestFromResource(d *deployment.Resource, environmentName, command string) deployment.ClientDeployRequest {
+	var request = deployment.ClientDeployRequest{}
+	HandleError(remarshal(d.Data, &request), command)
+	request.Annotations = d.MetaData.Annotations
+	request.Environment = EnvFromSelectorName(environmentName)
+	request.Requester = Requester()
+	return request
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+
+	"usi/pkg/type/deployment"
+)
+
+func TestDeploymentEnvironment(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		want        string
+		wantOK      bool
+	}{
+		{name: "recorded", environment: "dev", want: "dev", wantOK: true},
+		{name: "recorded with a selector", environment: "dev.feature", want: "dev.feature", wantOK: true},
+		{name: "not recorded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request deployment.ClientDeployRequest
+			if tt.environment != "" {
+				request.Environment = EnvFromSelectorName(tt.environment)
+			}
+			// the name alone doesn't tell the environment, e.g. api-dev-feature could be api-dev in feature
+			var d deployment.Resource
+			d.Name = "api-dev-feature"
+			if err := remarshal(request, &d.Data); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := deploymentEnvironment(&d)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("deploymentEnvironment() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -19,7 +19,7 @@ func CmdResolve(cmd *cli.Cmd) {
 	if err != nil {
 		HandleError(err, command)
 	}
-	cmd.Spec = "[ -a=<key1=value1,key2=value2> ] [ -e=<environment> ] [ -k ] [ -n=<name> ] [ -r=<dir> ] [ -o ] [ -p=<properties> ] [ -s=<selector1[,selector2]> ] [ -t=<target> ] [ --diff ] [ -f=<filename> ]"
+	cmd.Spec = "[ -a=<key1=value1,key2=value2> ] [ -e=<environment> ] [ -k ] [ -n=<name> ] [ -r=<dir> ] [ -o ] [ -p=<properties> ] [ -s=<selector1[,selector2]> ] [ -t=<target> ] [ --diff ] [ -f=<filename> ] [ --timeout=<duration> ]"
 	opts := NewOpts(cmd)
 	annotations := opts.AnnotationsOpt()
 	environment := opts.EnvironmentOpt()
@@ -32,6 +32,7 @@ func CmdResolve(cmd *cli.Cmd) {
 	shellEscape := opts.ShellEscapeOpt()
 	target := opts.TargetOpt(command)
 	diff := opts.DiffOpt()
+	timeout := opts.TimeoutOpt()
 	cmd.Action = func() {
 		opts.Normalize(command)
 		opts.Validate(command)
@@ -40,8 +41,16 @@ func CmdResolve(cmd *cli.Cmd) {
 
 		properties, err := StrToConfiguration(props)
 		HandleError(err, command)
+		op := StartOperation(command, timeout, nil)
+		op.Telemetry(map[string]interface{}{
+			"name":        name,
+			"environment": environment,
+			"target":      target,
+		})
+		op.Phase("build")
 		_, source := DecorateM5(name, environment, m5Dir, core.ResolveCmd, StrsToAnnotations(annotations),
 			StrToSelector(selector, command), properties, target, os.Stdout, os.Stderr)
+		op.Check(op.Err())
 		if *selector != "" {
 			source.M5.EnsureDeclaration()
 			source.M5.Declaration.OptionalSelector = selector
@@ -53,7 +62,9 @@ func CmdResolve(cmd *cli.Cmd) {
 		HandleError(err, command)
 		fmt.Fprintf(os.Stdout, "resolving [%s] to [%s]\n", *source.Path(), *core.JoinNameAndSelector(*request.Environment.Name, request.Environment.Selector))
 		request.Requester = Requester()
-		configuration, err := Workspace(target, os.Stdout, os.Stderr, command).Resolve(request)
+		op.Phase("resolve")
+		configuration, err := Await(op, Workspace(target, os.Stdout, os.Stderr, command).Resolve, request)
+		op.Done()
 		HandleResolveError(command, err)
 		switch {
 		case diff != nil && *diff:
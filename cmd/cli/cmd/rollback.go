@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+	"platform-go-common/pkg/errors"
+
+	"usi/pkg/core"
+	"usi/pkg/type/deployment"
+	"usi/pkg/type/environment"
+)
+
+const defaultRevisions = 10
+
+// Revision is one recorded version of a deployment, newest first when listed.
+type Revision struct {
+	Number     int
+	Time       time.Time
+	Requester  string
+	Active     bool
+	Deployment deployment.Resource
+}
+
+func CmdRollback(cmd *cli.Cmd) {
+	command := "rollback"
+	cmd.Spec = "-n=<name> [ -e=<environment> ] [ -s=<selector> ] [ --to=<revision> ] [ -m=<max> ] [ -d ] [ -w ] [ --force ] [ -y ] [ --lock-ttl=<duration> ]"
+	opts := NewOpts(cmd)
+	environmentName := opts.EnvironmentOpt()
+	name := opts.NameOpt()
+	selectorString := opts.SelectorOpt()
+	max := opts.MaxOpt()
+	dryRun := opts.DryRunOpt()
+	wait := opts.WaitOpt()
+	force := opts.ForceOpt()
+	lockTTL := opts.LockTTLOpt()
+	yes := opts.YesOpt()
+	to := cmd.IntOpt("to", 0, "revision to redeploy; lists the previous revisions when omitted")
+	Reporter.UsedOption("to", to)
+
+	cmd.Action = func() {
+		opts.Normalize(command)
+		opts.Validate(command)
+		environmentName = ToggleEnvironment(environmentName, name)
+		var environmentResource = &environment.Resource{}
+		ValidateAndRetrieveEnvironment(command, environmentName).Remarshal(environmentResource)
+		serviceName, serviceSelector := core.ParseSelectorNameAndAddCliSelector(*name, *selectorString) // already normalizes
+		normName := core.JoinNameAndSelector(serviceName, serviceSelector)
+		AssertDeployment(command, *environmentName, normName)
+		depReq := core.RequestFromTypeAndNameAndSelector(
+			deployment.TypeName,
+			*deployment.Name(*environmentName, serviceName, serviceSelector),
+			nil)
+
+		limit := *max
+		if limit <= 0 {
+			limit = defaultRevisions
+		}
+		revisions := DeploymentRevisions(command, depReq, limit+1)
+		if len(revisions) == 0 {
+			HandleError(errors.WithCode("no revisions recorded for this deployment", errors.NotFound), command)
+		}
+
+		if *to == 0 {
+			PrintHeader("Revisions: %s", *normName)
+			PrintRevisions(revisions, limit, command)
+			PrintFooter()
+			Reporter.SendHoneycombEvent(command, map[string]interface{}{
+				"environment":  environmentName,
+				"service_name": name,
+				"revisions":    len(revisions),
+				"result":       "success",
+			})
+			return
+		}
+
+		var target *Revision
+		for i := range revisions {
+			// the extra revision past limit is only the baseline of the oldest one listed
+			if i < limit && revisions[i].Number == *to {
+				target = &revisions[i]
+			}
+		}
+		if target == nil {
+			HandleError(errors.WithCode(fmt.Sprintf("revision %d not found in the last %d revisions, raise -m to look further back", *to, limit), errors.NotFound), command)
+		}
+		live := GetServiceDeployment(command, *environmentName, *normName, nil)
+		current := CurrentRevision(revisions, live, command)
+		if current != nil && current.Number == target.Number && !*force {
+			HandleError(errors.WithCode(fmt.Sprintf("revision %d is already deployed", *to), errors.BadRequest), command)
+		}
+
+		var baseline interface{}
+		fromRevision := 0
+		switch {
+		case current != nil:
+			PrintHeader("Changes from revision %d to revision %d", current.Number, target.Number)
+			baseline, fromRevision = current.Deployment.Data.Configuration, current.Number
+		case live != nil:
+			PrintHeader("Changes from the live deployment to revision %d", target.Number)
+			baseline = live.Data.Configuration
+		default:
+			PrintHeader("Changes to revision %d (not currently deployed)", target.Number)
+		}
+		changes, err := DiffFields(baseline, target.Deployment.Data.Configuration)
+		HandleError(err, command)
+		PrintFieldChanges(os.Stdout, changes, "  ")
+
+		request := DeployRequestFromResource(&target.Deployment, *environmentName, command)
+		request.Force = *force
+		request.DryRun = *dryRun
+		if !request.DryRun {
+			PrintHeader("* Rolling back %s to revision %d via usi", *normName, target.Number)
+		} else {
+			PrintHeader("* Rolling back %s to revision %d via usi (Dry Run)", *normName, target.Number)
+		}
+
+		var lock *DeployLock
+		if !request.DryRun {
+			ConfirmEnvironmentChange(command, *environmentName, environmentResource,
+				[]string{fmt.Sprintf("Rollback:  %s to revision %d", *normName, target.Number)}, *yes, *force)
+			lock = AcquireDeployLock(command, *environmentName, *name, *selectorString, ParseLockTTL(lockTTL, command), *force)
+		}
+		deployStart := time.Now()
+		deployResponse, err := Workspace(nil, os.Stdout, os.Stderr, command).Deploy(request)
+		lock.Release()
+		HandleResolveError(command, err)
+		if request.DryRun {
+			PrintYAML(deployResponse.Deployment, command)
+		}
+		deploymentDuration := time.Since(deployStart)
+		PrintHeader("Completed Rollback: %s (%s) in %vs", deployResponse.Deployment.Name, deployResponse.Deployment.UUID, roundFloat(deploymentDuration.Seconds(), 3))
+		if deployResponse.Warnings != nil {
+			for _, warning := range deployResponse.Warnings {
+				PrintWarning(warning)
+			}
+		}
+		HandleDeployWarning(deployResponse, command)
+
+		honeyCombMap := map[string]interface{}{
+			"environment":           environmentName,
+			"service_name":          name,
+			"selectors":             selectorString,
+			"dryrun":                strconv.FormatBool(*dryRun),
+			"from_revision":         fromRevision,
+			"to_revision":           target.Number,
+			"deployment_duration_s": deploymentDuration.Seconds(),
+			"result":                "success",
+		}
+		if *wait && !request.DryRun {
+			waitDur := WaitForDeployment(deployResponse.Deployment, *environmentName, command)
+			honeyCombMap["wait_duration_s"] = waitDur.Seconds()
+		}
+		Reporter.SendHoneycombEvent(command, honeyCombMap)
+		Reporter.SendSnowflakeEvent(command, map[string]interface{}{
+			"service_name": *name,
+			"additional_info": "environment:" + *environmentName + " dryrun:" + strconv.FormatBool(*dryRun) +
+				fmt.Sprintf(" from_revision:%d to_revision:%d", fromRevision, target.Number),
+			"environment": *environmentName,
+		})
+	}
+}
+
+// DeploymentRevisions returns up to max revisions of a deployment from the registry change log, newest first.
+func DeploymentRevisions(command string, request core.Request, max int) []Revision {
+	entries := ChangeLog(command, request, nil, max)
+	revisions := make([]Revision, 0, len(entries))
+	for _, entry := range entries {
+		revision := Revision{
+			Number:    entry.Revision,
+			Time:      entry.Timestamp,
+			Requester: fmt.Sprint(entry.Requester),
+			Active:    entry.Active,
+		}
+		HandleError(remarshal(entry.Resource, &revision.Deployment), command)
+		revisions = append(revisions, revision)
+	}
+	return revisions
+}
+
+// CurrentRevision returns the newest revision matching the stored fields of the live deployment,
+// or nil when nothing is deployed or the live deployment isn't among the revisions.
+func CurrentRevision(revisions []Revision, live *deployment.Resource, command string) *Revision {
+	if live == nil {
+		return nil
+	}
+	liveFields, err := revisionFields(live)
+	HandleError(err, command)
+	for i := range revisions {
+		fields, err := revisionFields(&revisions[i].Deployment)
+		HandleError(err, command)
+		changes, err := DiffFields(liveFields, fields)
+		HandleError(err, command)
+		if len(changes) == 0 {
+			return &revisions[i]
+		}
+	}
+	return nil
+}
+
+// PrintRevisions lists up to limit revisions with the configuration changes each one introduced.
+// The oldest revision fetched is only used as the baseline for the one after it.
+func PrintRevisions(revisions []Revision, limit int, command string) {
+	for i, revision := range revisions {
+		if i >= limit {
+			break
+		}
+		marker := ""
+		if revision.Active {
+			marker = " (active)"
+		}
+		fmt.Printf("Revision %d%s\n", revision.Number, marker)
+		fmt.Printf("  Deployed:    %s by %s\n", ConvertDateToLocalTZ(revision.Time).Format(time.RFC1123), revision.Requester)
+		fmt.Printf("  Annotations: %s\n", formatAnnotations(revision.Deployment.MetaData.Annotations, command))
+		if i+1 < len(revisions) {
+			changes, err := DiffFields(revisions[i+1].Deployment.Data.Configuration, revision.Deployment.Data.Configuration)
+			HandleError(err, command)
+			fmt.Printf("  Configuration changes since revision %d:\n", revisions[i+1].Number)
+			PrintFieldChanges(os.Stdout, changes, "    ")
+		}
+		fmt.Println("")
+	}
+}
+
+func formatAnnotations(annotations interface{}, command string) string {
+	fields, err := FlattenFields(annotations)
+	HandleError(err, command)
+	if len(fields) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(fields))
+	for key, value := range fields {
+		pairs = append(pairs, key+"="+truncate(value, 60))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
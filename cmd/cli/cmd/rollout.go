@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"usi/pkg/registry"
+)
+
+const (
+	defaultRolloutInterval = 2 * time.Second
+	// maxRolloutRetries is how many API errors in a row that are worth retrying Wait rides out,
+	// waiting up to maxRolloutBackoff between them.
+	maxRolloutRetries = 6
+	maxRolloutBackoff = 30 * time.Second
+	// defaultNotFoundTimeout is how long Wait waits for a workload to be created, so a deploy that
+	// never creates one doesn't keep wait running without --timeout.
+	defaultNotFoundTimeout = 5 * time.Minute
+)
+
+// RolloutFailedError is returned when a rollout itself failed, e.g. its progress deadline passed,
+// as opposed to the watcher being unable to follow it.
+type RolloutFailedError struct {
+	Reason string
+}
+
+func (e *RolloutFailedError) Error() string {
+	return e.Reason
+}
+
+// RolloutExitCode is how wait exits for an error from RolloutWatcher.Wait: ExitCodeRolloutFailed
+// only for a failed rollout and ExitCodeCannotWait for anything that kept it from following one.
+func RolloutExitCode(err error) int {
+	var failed *RolloutFailedError
+	if errors.As(err, &failed) {
+		return ExitCodeRolloutFailed
+	}
+	return ExitCodeCannotWait
+}
+
+// retryableAPIError tells errors that may go away on their own, e.g. the API server being briefly
+// unavailable or a dropped connection, apart from ones that keep failing such as a 401.
+func retryableAPIError(err error) bool {
+	switch {
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsTooManyRequests(err),
+		apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err), apierrors.IsUnexpectedServerError(err):
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// RolloutStatus is the progress of a rollout, with the same messages as `kubectl rollout status`.
+type RolloutStatus struct {
+	Done    bool
+	Message string
+	// Missing is set while no matching workload exists yet.
+	Missing bool
+}
+
+// RolloutWatcher follows the rollout of every Deployment or StatefulSet matching Selector in
+// Namespace. Client is a kubernetes.Interface so tests can pass a fake clientset.
+type RolloutWatcher struct {
+	Client    k8s.Interface
+	Namespace string
+	Kind      string
+	Selector  string
+	Interval  time.Duration
+	// NotFoundTimeout bounds how long no matching workload may exist, defaultNotFoundTimeout when zero.
+	NotFoundTimeout time.Duration
+	// Progress is called whenever the status message changes. Nil prints it to stdout.
+	Progress func(RolloutStatus)
+}
+
+// Wait polls until every matching workload has rolled out, the rollout fails or ctx is done.
+// Workloads that don't exist yet, e.g. right after a deploy, are waited for up to NotFoundTimeout.
+// API errors that may go away on their own are retried with a growing delay.
+func (w RolloutWatcher) Wait(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = defaultRolloutInterval
+	}
+	progress := w.Progress
+	if progress == nil {
+		progress = func(status RolloutStatus) {
+			fmt.Println(status.Message)
+		}
+	}
+
+	notFoundTimeout := w.NotFoundTimeout
+	if notFoundTimeout <= 0 {
+		notFoundTimeout = defaultNotFoundTimeout
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := ""
+	retries := 0
+	var missingSince time.Time
+	for {
+		status, err := w.Status(ctx)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && retryableAPIError(err) && retries < maxRolloutRetries {
+			retries++
+			backoff := interval << retries
+			if backoff > maxRolloutBackoff {
+				backoff = maxRolloutBackoff
+			}
+			last = fmt.Sprintf("Unable to get the rollout status, retrying in %v: %s", backoff, err.Error())
+			progress(RolloutStatus{Message: last})
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		retries = 0
+		switch {
+		case !status.Missing:
+			missingSince = time.Time{}
+		case missingSince.IsZero():
+			missingSince = time.Now()
+		case time.Since(missingSince) >= notFoundTimeout:
+			return &RolloutFailedError{Reason: fmt.Sprintf("no %s with %s was created within %v", strings.ToLower(w.Kind), w.Selector, notFoundTimeout)}
+		}
+		if status.Message != last {
+			progress(status)
+			last = status.Message
+		}
+		if status.Done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status checks the matching workloads once. The rollout is done when all of them are.
+func (w RolloutWatcher) Status(ctx context.Context) (RolloutStatus, error) {
+	list := metav1.ListOptions{LabelSelector: w.Selector}
+	var statuses []RolloutStatus
+	switch strings.ToLower(w.Kind) {
+	case "deployment", "deployments":
+		deployments, err := w.Client.AppsV1().Deployments(w.Namespace).List(ctx, list)
+		if err != nil {
+			return RolloutStatus{}, err
+		}
+		for i := range deployments.Items {
+			status, err := DeploymentRolloutStatus(&deployments.Items[i])
+			if err != nil {
+				return status, err
+			}
+			statuses = append(statuses, status)
+		}
+	case "statefulset", "statefulsets":
+		statefulSets, err := w.Client.AppsV1().StatefulSets(w.Namespace).List(ctx, list)
+		if err != nil {
+			return RolloutStatus{}, err
+		}
+		for i := range statefulSets.Items {
+			statuses = append(statuses, StatefulSetRolloutStatus(&statefulSets.Items[i]))
+		}
+	default:
+		return RolloutStatus{}, fmt.Errorf("waiting for a %s rollout is not supported, only deployment and statefulset", w.Kind)
+	}
+
+	if len(statuses) == 0 {
+		return RolloutStatus{Message: fmt.Sprintf("Waiting for %s with %s to be created...", strings.ToLower(w.Kind), w.Selector), Missing: true}, nil
+	}
+	for _, status := range statuses {
+		if !status.Done {
+			return status, nil
+		}
+	}
+	return statuses[0], nil
+}
+
+// DeploymentRolloutStatus follows the checks of `kubectl rollout status deployment`. It fails
+// once the deployment's progress deadline is exceeded.
+func DeploymentRolloutStatus(d *appsv1.Deployment) (RolloutStatus, error) {
+	if d.Generation > d.Status.ObservedGeneration {
+		return RolloutStatus{Message: fmt.Sprintf("Waiting for deployment %q spec update to be observed...", d.Name)}, nil
+	}
+	for _, condition := range d.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return RolloutStatus{}, &RolloutFailedError{Reason: fmt.Sprintf("deployment %q exceeded its progress deadline", d.Name)}
+		}
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	switch {
+	case d.Status.UpdatedReplicas < replicas:
+		return RolloutStatus{Message: fmt.Sprintf("Waiting for deployment %q rollout to finish: %d out of %d new replicas have been updated...",
+			d.Name, d.Status.UpdatedReplicas, replicas)}, nil
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		return RolloutStatus{Message: fmt.Sprintf("Waiting for deployment %q rollout to finish: %d old replicas are pending termination...",
+			d.Name, d.Status.Replicas-d.Status.UpdatedReplicas)}, nil
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		return RolloutStatus{Message: fmt.Sprintf("Waiting for deployment %q rollout to finish: %d of %d updated replicas are available...",
+			d.Name, d.Status.AvailableReplicas, d.Status.UpdatedReplicas)}, nil
+	}
+	return RolloutStatus{Done: true, Message: fmt.Sprintf("deployment %q successfully rolled out", d.Name)}, nil
+}
+
+// StatefulSetRolloutStatus follows the checks of `kubectl rollout status statefulset` for the
+// RollingUpdate strategy, including partitioned rollouts.
+func StatefulSetRolloutStatus(s *appsv1.StatefulSet) RolloutStatus {
+	if s.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		return RolloutStatus{Done: true, Message: fmt.Sprintf("statefulset %q uses the %s strategy, its rollout can't be followed", s.Name, s.Spec.UpdateStrategy.Type)}
+	}
+	if s.Status.ObservedGeneration == 0 || s.Generation > s.Status.ObservedGeneration {
+		return RolloutStatus{Message: fmt.Sprintf("Waiting for statefulset %q spec update to be observed...", s.Name)}
+	}
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+	if s.Status.ReadyReplicas < replicas {
+		return RolloutStatus{Message: fmt.Sprintf("Waiting for %d pods to be ready...", replicas-s.Status.ReadyReplicas)}
+	}
+	if rollingUpdate := s.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil && *rollingUpdate.Partition > 0 {
+		if s.Status.UpdatedReplicas < replicas-*rollingUpdate.Partition {
+			return RolloutStatus{Message: fmt.Sprintf("Waiting for partitioned roll out to finish: %d out of %d new pods have been updated...",
+				s.Status.UpdatedReplicas, replicas-*rollingUpdate.Partition)}
+		}
+		return RolloutStatus{Done: true, Message: fmt.Sprintf("partitioned roll out complete: %d new pods have been updated...", s.Status.UpdatedReplicas)}
+	}
+	if s.Status.UpdateRevision != s.Status.CurrentRevision {
+		return RolloutStatus{Message: fmt.Sprintf("waiting for statefulset %q rolling update to complete %d pods at revision %s...",
+			s.Name, s.Status.UpdatedReplicas, s.Status.UpdateRevision)}
+	}
+	return RolloutStatus{Done: true, Message: fmt.Sprintf("statefulset %q rolling update complete %d pods at revision %s...",
+		s.Name, s.Status.CurrentReplicas, s.Status.CurrentRevision)}
+}
+
+// NewKubernetesClient returns a client for the cluster of an environment. It is a variable so
+// tests can swap in a fake clientset.
+var NewKubernetesClient = func(envK8s *registry.EnvironmentKubernetesResponse) (k8s.Interface, error) {
+	config, err := RancherClusterConfig(envK8s)
+	if err != nil {
+		return nil, err
+	}
+	return k8s.NewForConfig(config)
+}
+
+// rancherCliConfig is the part of the Rancher CLI's ~/.rancher/cli2.json used to reach clusters.
+type rancherCliConfig struct {
+	Servers map[string]struct {
+		TokenKey string `json:"tokenKey"`
+		URL      string `json:"url"`
+		CACert   string `json:"cacert"`
+	}
+	CurrentServer string
+}
+
+// RancherClusterConfig connects to the cluster of an environment through the Rancher API proxy,
+// with the token from RANCHER_URL and RANCHER_TOKEN or else from the Rancher CLI login. Unlike
+// `rancher context switch` it leaves the user's Rancher context alone.
+func RancherClusterConfig(envK8s *registry.EnvironmentKubernetesResponse) (*rest.Config, error) {
+	if envK8s == nil || envK8s.Cluster == nil || envK8s.Cluster.ClusterId == nil {
+		return nil, fmt.Errorf("the environment has no kubernetes cluster")
+	}
+	server, token, caCert := os.Getenv("RANCHER_URL"), os.Getenv("RANCHER_TOKEN"), ""
+	if server == "" || token == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadFile(filepath.Join(home, ".rancher", "cli2.json"))
+		if err != nil {
+			return nil, fmt.Errorf("no Rancher credentials, run `rancher login` once or set RANCHER_URL and RANCHER_TOKEN. See http://cg/rancher-cli")
+		}
+		var cliConfig rancherCliConfig
+		if err := json.Unmarshal(b, &cliConfig); err != nil {
+			return nil, fmt.Errorf("unable to read the Rancher CLI config: %s", err.Error())
+		}
+		current, found := cliConfig.Servers[cliConfig.CurrentServer]
+		if !found || current.URL == "" || current.TokenKey == "" {
+			return nil, fmt.Errorf("the Rancher CLI isn't logged in, run `rancher login` once or set RANCHER_URL and RANCHER_TOKEN. See http://cg/rancher-cli")
+		}
+		server, token, caCert = current.URL, current.TokenKey, current.CACert
+	}
+
+	config := &rest.Config{
+		Host:        strings.TrimSuffix(server, "/") + "/k8s/clusters/" + *envK8s.Cluster.ClusterId,
+		BearerToken: token,
+	}
+	if caCert != "" {
+		config.TLSClientConfig.CAData = []byte(caCert)
+	}
+	return config, nil
+}
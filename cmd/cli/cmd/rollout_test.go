@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func testDeployment(replicas int32, status appsv1.DeploymentStatus) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "user-jdoe", Labels: map[string]string{"app": "api"}, Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(replicas)},
+		Status:     status,
+	}
+}
+
+func testStatefulSet(replicas int32, partition *int32, status appsv1.StatefulSetStatus) *appsv1.StatefulSet {
+	s := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "user-jdoe", Labels: map[string]string{"app": "db"}, Generation: 2},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:       int32Ptr(replicas),
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType},
+		},
+		Status: status,
+	}
+	if partition != nil {
+		s.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{Partition: partition}
+	}
+	return s
+}
+
+var (
+	deploymentComplete = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}
+	deploymentUpdating = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 1}
+	deploymentStuck    = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, Conditions: []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentProgressing, Status: "False", Reason: "ProgressDeadlineExceeded"},
+	}}
+)
+
+func TestDeploymentRolloutStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   appsv1.DeploymentStatus
+		wantDone bool
+		wantMsg  string
+		wantErr  bool
+	}{
+		{name: "spec not observed", status: appsv1.DeploymentStatus{ObservedGeneration: 1}, wantMsg: "spec update to be observed"},
+		{name: "progressing", status: deploymentUpdating, wantMsg: "1 out of 3 new replicas have been updated"},
+		{name: "old replicas terminating", status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3, AvailableReplicas: 3},
+			wantMsg: "1 old replicas are pending termination"},
+		{name: "updated replicas not available", status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 2},
+			wantMsg: "2 of 3 updated replicas are available"},
+		{name: "complete", status: deploymentComplete, wantDone: true, wantMsg: "successfully rolled out"},
+		{name: "progress deadline exceeded", status: deploymentStuck, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DeploymentRolloutStatus(testDeployment(3, tt.status))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeploymentRolloutStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Done != tt.wantDone || !strings.Contains(got.Message, tt.wantMsg) {
+				t.Errorf("DeploymentRolloutStatus() = %+v, want done %v and %q", got, tt.wantDone, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestStatefulSetRolloutStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		partition *int32
+		onDelete  bool
+		status    appsv1.StatefulSetStatus
+		wantDone  bool
+		wantMsg   string
+	}{
+		{name: "on delete strategy", onDelete: true, wantDone: true, wantMsg: "can't be followed"},
+		{name: "spec not observed", status: appsv1.StatefulSetStatus{ObservedGeneration: 1}, wantMsg: "spec update to be observed"},
+		{name: "pods not ready", status: appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 1}, wantMsg: "Waiting for 2 pods to be ready"},
+		{name: "rolling update in progress", status: appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 1,
+			CurrentRevision: "db-1", UpdateRevision: "db-2"}, wantMsg: "rolling update to complete 1 pods at revision db-2"},
+		{name: "rolling update complete", status: appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 3, CurrentReplicas: 3,
+			CurrentRevision: "db-2", UpdateRevision: "db-2"}, wantDone: true, wantMsg: "rolling update complete 3 pods at revision db-2"},
+		{name: "partitioned in progress", partition: int32Ptr(1), status: appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 1,
+			CurrentRevision: "db-1", UpdateRevision: "db-2"}, wantMsg: "1 out of 2 new pods have been updated"},
+		{name: "partitioned complete", partition: int32Ptr(1), status: appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 2,
+			CurrentRevision: "db-1", UpdateRevision: "db-2"}, wantDone: true, wantMsg: "partitioned roll out complete: 2 new pods"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testStatefulSet(3, tt.partition, tt.status)
+			if tt.onDelete {
+				s.Spec.UpdateStrategy.Type = appsv1.OnDeleteStatefulSetStrategyType
+			}
+			got := StatefulSetRolloutStatus(s)
+			if got.Done != tt.wantDone || !strings.Contains(got.Message, tt.wantMsg) {
+				t.Errorf("StatefulSetRolloutStatus() = %+v, want done %v and %q", got, tt.wantDone, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestRolloutWatcherWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    string
+		objects []runtime.Object
+		// complete is applied to the fake cluster after the first status, nil leaves it alone
+		complete     runtime.Object
+		wantErr      string
+		wantMessages []string
+		// notFoundTimeout is the watcher's NotFoundTimeout, zero keeps the default
+		notFoundTimeout time.Duration
+	}{
+		{name: "complete", kind: "Deployment", objects: []runtime.Object{testDeployment(3, deploymentComplete)},
+			wantMessages: []string{`deployment "api" successfully rolled out`}},
+		{name: "progressing then complete", kind: "Deployment", objects: []runtime.Object{testDeployment(3, deploymentUpdating)},
+			complete: testDeployment(3, deploymentComplete),
+			wantMessages: []string{
+				`Waiting for deployment "api" rollout to finish: 1 out of 3 new replicas have been updated...`,
+				`deployment "api" successfully rolled out`,
+			}},
+		{name: "progress deadline exceeded", kind: "Deployment", objects: []runtime.Object{testDeployment(3, deploymentStuck)},
+			wantErr: "exceeded its progress deadline"},
+		{name: "not created before the deadline", kind: "Deployment", wantErr: context.DeadlineExceeded.Error(),
+			wantMessages: []string{"Waiting for deployment with app=api to be created..."}},
+		{name: "never created", kind: "Deployment", notFoundTimeout: 20 * time.Millisecond, wantErr: "no deployment with app=api was created within 20ms",
+			wantMessages: []string{"Waiting for deployment with app=api to be created..."}},
+		{name: "partitioned statefulset", kind: "StatefulSet", objects: []runtime.Object{testStatefulSet(3, int32Ptr(2),
+			appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 1, CurrentRevision: "db-1", UpdateRevision: "db-2"})},
+			wantMessages: []string{"partitioned roll out complete: 1 new pods have been updated..."}},
+		{name: "unsupported kind", kind: "DaemonSet", wantErr: "not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(tt.objects...)
+			selector := "app=api"
+			if tt.kind == "StatefulSet" {
+				selector = "app=db"
+			}
+			var messages []string
+			watcher := RolloutWatcher{
+				Client:          client,
+				Namespace:       "user-jdoe",
+				Kind:            tt.kind,
+				Selector:        selector,
+				Interval:        5 * time.Millisecond,
+				NotFoundTimeout: tt.notFoundTimeout,
+				Progress: func(status RolloutStatus) {
+					messages = append(messages, status.Message)
+					if d, ok := tt.complete.(*appsv1.Deployment); ok && len(messages) == 1 {
+						if _, err := client.AppsV1().Deployments(d.Namespace).UpdateStatus(context.Background(), d, metav1.UpdateOptions{}); err != nil {
+							t.Fatalf("update deployment: %v", err)
+						}
+					}
+				},
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err := watcher.Wait(ctx)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Wait() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Wait() error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.wantMessages != nil && strings.Join(messages, "\n") != strings.Join(tt.wantMessages, "\n") {
+				t.Errorf("progress = %q, want %q", messages, tt.wantMessages)
+			}
+		})
+	}
+}
+
+func TestRolloutWatcherWaitRetries(t *testing.T) {
+	resource := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	tests := []struct {
+		name     string
+		errs     []error
+		wantErr  bool
+		wantCode int
+		wantList int
+	}{
+		{name: "unavailable then complete", errs: []error{apierrors.NewServiceUnavailable("restarting"), apierrors.NewTooManyRequests("slow down", 0)},
+			wantList: 3},
+		{name: "unauthorized", errs: []error{apierrors.NewUnauthorized("token expired")}, wantErr: true, wantCode: ExitCodeCannotWait, wantList: 1},
+		{name: "forbidden", errs: []error{apierrors.NewForbidden(resource, "", fmt.Errorf("no access"))}, wantErr: true,
+			wantCode: ExitCodeCannotWait, wantList: 1},
+		{name: "unavailable for too long", errs: []error{
+			apierrors.NewInternalError(fmt.Errorf("etcd")), apierrors.NewInternalError(fmt.Errorf("etcd")), apierrors.NewInternalError(fmt.Errorf("etcd")),
+			apierrors.NewInternalError(fmt.Errorf("etcd")), apierrors.NewInternalError(fmt.Errorf("etcd")), apierrors.NewInternalError(fmt.Errorf("etcd")),
+			apierrors.NewInternalError(fmt.Errorf("etcd")),
+		}, wantErr: true, wantCode: ExitCodeCannotWait, wantList: maxRolloutRetries + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(testDeployment(3, deploymentComplete))
+			lists := 0
+			client.PrependReactor("list", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+				lists++
+				if lists <= len(tt.errs) {
+					return true, nil, tt.errs[lists-1]
+				}
+				return false, nil, nil
+			})
+			watcher := RolloutWatcher{Client: client, Namespace: "user-jdoe", Kind: "Deployment", Selector: "app=api",
+				Interval: time.Microsecond, Progress: func(RolloutStatus) {}}
+			err := watcher.Wait(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Wait() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && RolloutExitCode(err) != tt.wantCode {
+				t.Errorf("RolloutExitCode(%v) = %d, want %d", err, RolloutExitCode(err), tt.wantCode)
+			}
+			if lists != tt.wantList {
+				t.Errorf("listed %d times, want %d", lists, tt.wantList)
+			}
+		})
+	}
+}
+
+func TestRolloutExitCode(t *testing.T) {
+	_, deadline := DeploymentRolloutStatus(testDeployment(3, deploymentStuck))
+	unsupported := RolloutWatcher{Client: fake.NewSimpleClientset(), Kind: "DaemonSet"}.Wait(context.Background())
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "progress deadline exceeded", err: deadline, want: ExitCodeRolloutFailed},
+		{name: "wrapped rollout failure", err: fmt.Errorf("api: %w", deadline), want: ExitCodeRolloutFailed},
+		{name: "unsupported kind", err: unsupported, want: ExitCodeCannotWait},
+		{name: "unauthorized", err: apierrors.NewUnauthorized("token expired"), want: ExitCodeCannotWait},
+	}
+	for _, tt := range tests {
+		if got := RolloutExitCode(tt.err); got != tt.want {
+			t.Errorf("%s: RolloutExitCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
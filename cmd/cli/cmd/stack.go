@@ -0,0 +1,411 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"platform-go-common/pkg/errors"
+
+	"usi/pkg/core"
+	"usi/pkg/registry"
+	"usi/pkg/type/deployment"
+)
+
+const (
+	stackDeployed  = "deployed"
+	stackFailed    = "failed"
+	stackSkipped   = "skipped"
+	stackCancelled = "cancelled"
+)
+
+// StackFile lists services that are deployed together, e.g.
+//
+//	services:
+//	  - name: api
+//	    dir: ../api
+//	  - name: web.feature
+//	    target: local
+//	  - worker
+type StackFile struct {
+	Services []StackService `yaml:"services"`
+}
+
+type StackService struct {
+	Name   string `yaml:"name"`
+	Dir    string `yaml:"dir"`
+	Target string `yaml:"target"`
+}
+
+// UnmarshalYAML accepts either a bare service name or a full entry.
+func (s *StackService) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		s.Name = name
+		return nil
+	}
+	type plain StackService
+	return unmarshal((*plain)(s))
+}
+
+type stackNode struct {
+	service   StackService
+	fullName  string
+	deps      []int
+	status    string
+	reason    string
+	duration  time.Duration
+	completed chan struct{}
+}
+
+func ReadStackFile(filename, command string) []StackService {
+	b, err := ioutil.ReadFile(filename)
+	HandleError(err, command)
+	var stack StackFile
+	if err := yaml.Unmarshal(b, &stack); err != nil {
+		HandleError(errors.WithCode(fmt.Sprintf("invalid stack file %s: %s", filename, err.Error()), errors.BadRequest), command)
+	}
+	for i, service := range stack.Services {
+		if service.Name == "" {
+			HandleError(errors.WithCode(fmt.Sprintf("stack file %s: service %d has no name", filename, i+1), errors.BadRequest), command)
+		}
+	}
+	return stack.Services
+}
+
+// StackServices merges -n, the SERVICES arguments and the stack file, keeping the first entry for a name.
+func StackServices(name string, names []string, stackFile, command string) []StackService {
+	var services []StackService
+	if name != "" {
+		services = append(services, StackService{Name: name})
+	}
+	for _, n := range names {
+		services = append(services, StackService{Name: n})
+	}
+	if stackFile != "" {
+		services = append(services, ReadStackFile(stackFile, command)...)
+	}
+
+	seen := make(map[string]bool, len(services))
+	unique := make([]StackService, 0, len(services))
+	for _, service := range services {
+		service.Name = core.NormalizeSelectorName(service.Name)
+		if seen[service.Name] {
+			continue
+		}
+		seen[service.Name] = true
+		unique = append(unique, service)
+	}
+	return unique
+}
+
+// DeployStack deploys each service with its own `usi deploy` process. A service starts once every
+// service it depends on within the stack has deployed, and is skipped when one of them failed. When
+// op is cancelled the running deploys are stopped and the ones still waiting never start.
+func DeployStack(op *Operation, command string, deployOpts DeployOpts, services []StackService, parallel int) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	if deployOpts.logs != nil && *deployOpts.logs {
+		PrintWarning("Ignoring -l when deploying several services")
+		*deployOpts.logs = false
+	}
+
+	op.Phase("dependencies")
+	nodes := stackGraph(op, command, *deployOpts.env, services)
+	levels := stackLevels(nodes)
+	if levels == nil {
+		HandleError(errors.WithCode("Services in the stack depend on each other in a cycle: "+stackCycle(nodes), errors.BadRequest), command)
+	}
+	PrintHeader("* Deploying %d services via usi", len(nodes))
+	for i, level := range levels {
+		names := make([]string, 0, len(level))
+		for _, n := range level {
+			names = append(names, nodes[n].fullName)
+		}
+		fmt.Printf("  %d. %s\n", i+1, strings.Join(names, ", "))
+	}
+	fmt.Println("")
+
+	executable, err := os.Executable()
+	HandleError(err, command)
+
+	var outMu sync.Mutex
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	start := time.Now()
+	op.Phase("deploy")
+	op.OnAbort(func() {
+		PrintStackSummary(nodes, time.Since(start))
+	})
+	for i := range nodes {
+		wg.Add(1)
+		go func(node *stackNode) {
+			defer wg.Done()
+			defer close(node.completed)
+			for _, dep := range node.deps {
+				<-nodes[dep].completed
+				if nodes[dep].status != stackDeployed {
+					node.status = stackSkipped
+					node.reason = nodes[dep].fullName + " " + nodes[dep].status
+					return
+				}
+			}
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-op.Context().Done():
+			}
+			if err := op.Err(); err != nil {
+				node.status = stackCancelled
+				node.reason = err.Error()
+				return
+			}
+
+			serviceStart := time.Now()
+			err := runStackDeploy(op.Context(), executable, deployOpts, node.service, &outMu)
+			node.duration = time.Since(serviceStart)
+			if err != nil && op.Err() != nil {
+				node.status = stackCancelled
+				node.reason = op.Err().Error()
+				return
+			}
+			if err != nil {
+				node.status = stackFailed
+				node.reason = err.Error()
+				return
+			}
+			node.status = stackDeployed
+		}(&nodes[i])
+	}
+	wg.Wait()
+	op.Done()
+
+	failed := PrintStackSummary(nodes, time.Since(start))
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.service.Name)
+	}
+	result := "success"
+	if failed > 0 {
+		result = "failure"
+	}
+	Reporter.SendHoneycombEvent(command, map[string]interface{}{
+		"environment":           deployOpts.env,
+		"services":              strings.Join(names, ","),
+		"parallel":              parallel,
+		"failed":                failed,
+		"deployment_duration_s": time.Since(start).Seconds(),
+		"result":                result,
+	})
+	Reporter.SendSnowflakeEvent(command, map[string]interface{}{
+		"service_name":    strings.Join(names, ","),
+		"additional_info": "environment:" + *deployOpts.env + fmt.Sprintf(" parallel:%d failed:%d", parallel, failed),
+		"environment":     *deployOpts.env,
+	})
+	if failed > 0 {
+		HandleError(errors.WithCode(fmt.Sprintf("%d of %d deployments did not complete", failed, len(nodes)), errors.BadRequest), command)
+	}
+}
+
+// stackGraph looks up the registry dependencies of every service and keeps the ones within the stack.
+func stackGraph(op *Operation, command, environmentName string, services []StackService) []stackNode {
+	nodes := make([]stackNode, len(services))
+	byName := make(map[string]int, len(services))
+	for i, service := range services {
+		serviceName, selector, err := core.ParseSelectorName(service.Name)
+		HandleError(err, command)
+		nodes[i] = stackNode{
+			service:   service,
+			fullName:  *deployment.Name(environmentName, serviceName, selector),
+			completed: make(chan struct{}),
+		}
+		byName[nodes[i].fullName] = i
+	}
+
+	Environment := EnvFromSelectorName(environmentName)
+	for i := range nodes {
+		name := nodes[i].service.Name
+		var request registry.DependenciesRequest
+		request.Deployment.Name = &name
+		request.Environment = &Environment
+		dependencies, err := Await(op, Workspace(nil, os.Stdout, os.Stderr, command).Dependencies, request)
+		op.Check(err)
+		if isNotFound(err) {
+			// a service that was never deployed has no recorded dependencies yet
+			continue
+		}
+		HandleError(err, command)
+		for _, dependency := range dependencies {
+			if j, ok := byName[dependency.Name]; ok && j != i {
+				nodes[i].deps = append(nodes[i].deps, j)
+			}
+		}
+	}
+	return nodes
+}
+
+// stackLevels groups the nodes into deploy waves using Kahn's algorithm. It returns nil on a cycle.
+func stackLevels(nodes []stackNode) [][]int {
+	pending := make([]int, len(nodes))
+	dependents := make([][]int, len(nodes))
+	for i, node := range nodes {
+		pending[i] = len(node.deps)
+		for _, dep := range node.deps {
+			dependents[dep] = append(dependents[dep], i)
+		}
+	}
+
+	var level []int
+	for i := range nodes {
+		if pending[i] == 0 {
+			level = append(level, i)
+		}
+	}
+	var levels [][]int
+	visited := 0
+	for len(level) > 0 {
+		levels = append(levels, level)
+		visited += len(level)
+		var next []int
+		for _, n := range level {
+			for _, dependent := range dependents[n] {
+				pending[dependent]--
+				if pending[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
+		}
+		sort.Ints(next)
+		level = next
+	}
+	if visited != len(nodes) {
+		return nil
+	}
+	return levels
+}
+
+// stackCycle names the services that could not be ordered.
+func stackCycle(nodes []stackNode) string {
+	ordered := make(map[int]bool)
+	for changed := true; changed; {
+		changed = false
+		for i, node := range nodes {
+			if ordered[i] {
+				continue
+			}
+			ready := true
+			for _, dep := range node.deps {
+				ready = ready && ordered[dep]
+			}
+			if ready {
+				ordered[i] = true
+				changed = true
+			}
+		}
+	}
+	var names []string
+	for i, node := range nodes {
+		if !ordered[i] {
+			names = append(names, node.fullName)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func runStackDeploy(ctx context.Context, executable string, deployOpts DeployOpts, service StackService, outMu *sync.Mutex) error {
+	name := service.Name
+	opts := deployOpts
+	opts.name = &name
+	if service.Dir != "" {
+		opts.m5Dir = &service.Dir
+	}
+	if service.Target != "" {
+		opts.target = &service.Target
+	}
+
+	prefix := "[" + service.Name + "] "
+	out := &prefixWriter{mu: outMu, w: os.Stdout, prefix: prefix}
+	errOut := &prefixWriter{mu: outMu, w: os.Stderr, prefix: prefix}
+	var stderr bytes.Buffer
+	cmd := exec.Command(executable, append([]string{"deploy"}, opts.Args()...)...)
+	cmd.Stdout = out
+	cmd.Stderr = io.MultiWriter(errOut, &stderr)
+	err := RunChild(ctx, cmd)
+	out.Flush()
+	errOut.Flush()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+			return fmt.Errorf("%s", last)
+		}
+		return err
+	}
+	return nil
+}
+
+// PrintStackSummary prints one row per service and returns how many did not deploy.
+func PrintStackSummary(nodes []stackNode, total time.Duration) int {
+	fmt.Println("__________________________________________________________________")
+	PrintHeader("Stack Deployment Summary (%vs)", roundFloat(total.Seconds(), 3))
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "SERVICE\tSTATUS\tDURATION\tDETAILS")
+	for _, node := range nodes {
+		duration := "-"
+		if node.duration > 0 {
+			duration = fmt.Sprintf("%vs", roundFloat(node.duration.Seconds(), 3))
+		}
+		if node.status != stackDeployed {
+			failed++
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", node.fullName, node.status, duration, node.reason)
+	}
+	_ = w.Flush()
+	return failed
+}
+
+// prefixWriter prefixes every complete line with the service name so parallel deploys stay readable.
+// Writers sharing a mutex never interleave within a line.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+}
+
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, _ = io.WriteString(p.w, p.prefix)
+	_, _ = p.w.Write(line)
+}
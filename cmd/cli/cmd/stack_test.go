@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+// stackNodes builds nodes named after their index with the given dependencies.
+func stackNodes(deps ...[]int) []stackNode {
+	nodes := make([]stackNode, len(deps))
+	for i, d := range deps {
+		nodes[i] = stackNode{fullName: string(rune('a' + i)), deps: d}
+	}
+	return nodes
+}
+
+func TestStackLevels(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []stackNode
+		want  [][]int
+	}{
+		{name: "empty", nodes: stackNodes()},
+		{name: "independent", nodes: stackNodes(nil, nil, nil), want: [][]int{{0, 1, 2}}},
+		{name: "chain", nodes: stackNodes([]int{1}, []int{2}, nil), want: [][]int{{2}, {1}, {0}}},
+		{name: "diamond", nodes: stackNodes(nil, []int{0}, []int{0}, []int{1, 2}), want: [][]int{{0}, {1, 2}, {3}}},
+		{name: "uneven depths", nodes: stackNodes([]int{3}, nil, []int{1}, []int{2}), want: [][]int{{1}, {2}, {3}, {0}}},
+		{name: "cycle", nodes: stackNodes([]int{1}, []int{0}, nil)},
+		{name: "self dependency", nodes: stackNodes([]int{0})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stackLevels(tt.nodes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stackLevels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStackCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []stackNode
+		want  string
+	}{
+		{name: "no cycle", nodes: stackNodes(nil, []int{0}), want: ""},
+		{name: "two services", nodes: stackNodes([]int{1}, []int{0}, nil), want: "a, b"},
+		{name: "blocked by a cycle", nodes: stackNodes(nil, []int{2}, []int{3}, []int{1}, []int{1}), want: "b, c, d, e"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stackCycle(tt.nodes); got != tt.want {
+				t.Errorf("stackCycle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"usi/pkg/registry"
 	"usi/pkg/type/deployment"
+	environmentType "usi/pkg/type/environment"
 
 	cli "github.com/jawher/mow.cli"
 	"platform-go-common/pkg/errors"
@@ -15,22 +16,28 @@ import (
 
 func CmdUndeploy(cmd *cli.Cmd) {
 	command := "undeploy"
-	cmd.Spec = "[ -e=<environment> ] [ -n=<name> ] [ -s=<selector> ] [ --force ]"
+	cmd.Spec = "[ -e=<environment> ] [ -n=<name> ] [ -s=<selector> ] [ --force ] [ -y ] [ --lock-ttl=<duration> ]"
 	opts := NewOpts(cmd)
 	environment := opts.EnvironmentOpt()
 	name := opts.NameOpt()
 	selectorString := opts.SelectorOpt()
 	force := opts.ForceOpt()
+	lockTTL := opts.LockTTLOpt()
+	yes := opts.YesOpt()
 
 	cmd.Action = func() {
 		opts.Normalize(command)
 		opts.Validate(command)
 		if name != nil && *name != "" {
 			environment = ToggleEnvironment(environment, name)
-			_ = ValidateAndRetrieveEnvironment(command, environment)
+			var environmentResource = &environmentType.Resource{}
+			ValidateAndRetrieveEnvironment(command, environment).Remarshal(environmentResource)
 			serviceName, serviceSelector := core.ParseSelectorNameAndAddCliSelector(*name, *selectorString) // already normalizes
 			normName := core.JoinNameAndSelector(serviceName, serviceSelector)
 			AssertDeployment(command, *environment, normName)
+			ConfirmEnvironmentChange(command, *environment, environmentResource,
+				[]string{"Remove:    " + *normName}, *yes, *force)
+			lock := AcquireDeployLock(command, *environment, *name, *selectorString, ParseLockTTL(lockTTL, command), *force)
 			PrintHeader("Removing Deployment")
 			depReq := core.RequestFromTypeAndNameAndSelector(
 				deployment.TypeName,
@@ -41,11 +48,15 @@ func CmdUndeploy(cmd *cli.Cmd) {
 				request.Force = *force
 			}
 			undeployResponse, err := Workspace(nil, os.Stdout, os.Stderr, command).Undeploy(request)
-			HandleResolveError("undeploy", err)
+			lock.CheckResolve("undeploy", err)
+			lock.Release()
 			PrintYAML(undeployResponse.Environment, command)
 			HandleUndeployWarning(undeployResponse, command)
 		} else if selectorString != nil && *selectorString != "" {
-			_ = ValidateAndRetrieveEnvironment(command, environment)
+			var environmentResource = &environmentType.Resource{}
+			ValidateAndRetrieveEnvironment(command, environment).Remarshal(environmentResource)
+			ConfirmEnvironmentChange(command, *environment, environmentResource,
+				[]string{"Remove:    every deployment with selector " + *selectorString}, *yes, *force)
 			var request registry.CleanEnvironmentRequest
 			request.Selector = core.ParseAndNormalizeSelector(*selectorString)
 			request.Requester = Requester()
@@ -4,6 +4,8 @@ import (
 	"regexp"
 	"time"
 
+	"platform-go-common/pkg/errors"
+
 	"usi/pkg/type/deployment"
 )
 
@@ -27,3 +29,9 @@ func ConvertDateToLocalTZ(date time.Time) time.Time {
 
 	return userLocalTime
 }
+
+// isNotFound tells a missing resource apart from registry and connection failures.
+func isNotFound(err error) bool {
+	e, ok := err.(*errors.Error)
+	return ok && e.Code == errors.NotFound
+}
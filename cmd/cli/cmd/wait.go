@@ -1,14 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
 	"github.com/gen2brain/beeep"
 	cli "github.com/jawher/mow.cli"
+	k8s "k8s.io/client-go/kubernetes"
 	"platform-go-common/pkg/errors"
 
 	"usi/pkg/kubernetes"
@@ -20,17 +21,25 @@ import (
 
 func CmdWait(cmd *cli.Cmd) {
 	command := "wait"
-	cmd.Spec = "(-n=<serviceName> [-s=<selector>] [-e=<environment>])"
+	cmd.Spec = "[ -n=<serviceName> ] [ -s=<selector> ] [ -e=<environment> ] [ --timeout=<duration> ] [ --http-ready ] [ SERVICES... ]"
 	opts := NewOpts(cmd)
 
 	environmentName := opts.EnvironmentOpt()
 	name := opts.NameOpt()
 	selectorStr := opts.SelectorOpt()
+	timeout := opts.TimeoutOpt()
+	httpReady := opts.HTTPReadyOpt()
+	services := cmd.StringsArg("SERVICES", nil, "more deployments to wait for together with -n; without any, every deployment of the environment matching -s is waited for")
+	Reporter.UsedOption("services", services)
 
 	var waitDur time.Duration
 	cmd.Action = func() {
 		opts.Normalize(command)
 		opts.Validate(command)
+		if *name == "" || len(*services) > 0 {
+			WaitForAll(command, environmentName, name, selectorStr, *services, timeout, *httpReady)
+			return
+		}
 
 		environmentName = ToggleEnvironment(environmentName, name)
 		selector := StrToSelector(selectorStr, command)
@@ -38,7 +47,19 @@ func CmdWait(cmd *cli.Cmd) {
 		AssertDeployment(command, *environmentName, normName)
 		deployment := GetServiceDeployment(command, *environmentName, *name, selector)
 		if deployment != nil {
-			waitDur = WaitForDeployment(deployment, *environmentName, command)
+			op := StartOperation(command, timeout, nil)
+			op.Telemetry(map[string]interface{}{
+				"environment":  environmentName,
+				"service_name": name,
+				"selectors":    selectorStr,
+			})
+			op.Phase("wait")
+			waitDur = WaitForDeploymentContext(op.Context(), deployment, *environmentName, command)
+			if *httpReady {
+				op.Phase("http ready")
+				waitDur += WaitForDeploymentReady(op.Context(), deployment, command)
+			}
+			op.Done()
 		} else {
 			HandleError(
 				errors.WithCode(errors.InvalidServiceDeploymentErrorMessage, errors.NotFound),
@@ -62,9 +83,75 @@ func CmdWait(cmd *cli.Cmd) {
 	}
 }
 
+// WaitForAll is `usi wait` for several deployments: the named ones, or every deployment of the
+// environment matching the selector.
+func WaitForAll(command string, environmentName, name, selectorStr *string, services []string, timeout *string, httpReady bool) {
+	var names []string
+	if *name != "" {
+		environmentName = ToggleEnvironment(environmentName, name)
+		names = append(names, *name)
+	}
+	for _, service := range services {
+		names = append(names, core.NormalizeSelectorName(service))
+	}
+	_ = ValidateAndRetrieveEnvironment(command, environmentName)
+	deployments := WaitDeployments(command, *environmentName, names, *selectorStr)
+	if len(deployments) == 0 {
+		HandleError(errors.WithCode(fmt.Sprintf("No deployments to wait for in environment %s", *environmentName), errors.NotFound), command)
+	}
+
+	rowNames := make([]string, 0, len(deployments))
+	for _, d := range deployments {
+		rowNames = append(rowNames, d.Name)
+	}
+	PrintHeader("Waiting for %d deployments in %s ...", len(deployments), *environmentName)
+	table := NewWaitTable(os.Stdout, rowNames)
+	op := StartOperation(command, timeout, nil)
+	op.Telemetry(map[string]interface{}{
+		"environment": environmentName,
+		"selectors":   selectorStr,
+		"deployments": len(deployments),
+	})
+	op.OnAbort(table.PrintSummary)
+	op.Phase("wait")
+	start := time.Now()
+	WaitForDeployments(op.Context(), deployments, *environmentName, command, httpReady, table)
+	// a timeout or Ctrl-C ends here with its own exit code, before the failures below are counted
+	op.Done()
+	waitDur := time.Since(start)
+
+	failed, exitCode := table.Failures()
+	if len(failed) > 0 {
+		ExitWithCode(command, exitCode, fmt.Sprintf("%d of %d deployments didn't become ready: %s",
+			len(failed), len(deployments), strings.Join(failed, ", ")), map[string]interface{}{
+			"environment":     *environmentName,
+			"deployments":     len(deployments),
+			"failed":          len(failed),
+			"wait_duration_s": waitDur.Seconds(),
+			"result":          "failure",
+		})
+	}
+	Reporter.SendHoneycombEvent(command, map[string]interface{}{
+		"environment":     environmentName,
+		"selectors":       selectorStr,
+		"deployments":     len(deployments),
+		"wait_duration_s": waitDur.Seconds(),
+		"result":          "success",
+	})
+	Reporter.SendSnowflakeEvent(command, map[string]interface{}{
+		"service_name":    strings.Join(rowNames, ","),
+		"additional_info": " selectors:" + *selectorStr + fmt.Sprintf(" deployments:%d wait_duration_s:%f", len(deployments), waitDur.Seconds()),
+		"environment":     *environmentName,
+		"wait_duration_s": waitDur.Seconds(),
+	})
+}
+
 func WaitForDeployment(deployment *deployment.Resource, environment, command string) time.Duration {
-	// Validate that wait can be run
-	validateRancherCli(command)
+	return WaitForDeploymentContext(context.Background(), deployment, environment, command)
+}
+
+// WaitForDeploymentContext stops waiting when ctx is cancelled, leaving the report to the caller.
+func WaitForDeploymentContext(ctx context.Context, deployment *deployment.Resource, environment, command string) time.Duration {
 	// Wait can only be run against deployments in the user cluster
 	devDeploy := IsDevEnvironmentDeployment(deployment, command)
 	if !devDeploy {
@@ -78,74 +165,43 @@ func WaitForDeployment(deployment *deployment.Resource, environment, command str
 	}
 
 	PrintHeader(fmt.Sprintf("Waiting for %s deployment ...", deployment.Name))
-	PrintWarning("The service must have a startup probe in order to wait for application startup. Otherwise waiting will just return when the container starts up!\n")
+	PrintWarning("The service must have a startup probe in order to wait for application startup. Otherwise waiting will just return when the container starts up, unless --http-ready is used!\n")
 
-	var deploymentK8sName, deploymentK8sKind string
-	var found bool
-	if deploymentK8sName, found = deployment.Annotations[kubernetes.AnnotationK8sNameKey]; !found {
-		HandleError(
-			errors.WithCode(
-				"Unable to determine deployment name from annotations",
-				errors.BadRequest,
-			),
-			command,
-		)
+	envK8s := GetEnvironmentKubernetes(command, environment)
+	client, err := NewKubernetesClient(envK8s)
+	if err != nil {
+		ExitWithCode(command, ExitCodeCannotWait,
+			fmt.Sprintf("Unable to connect to the kubernetes cluster of environment %s: %s", environment, err.Error()),
+			map[string]interface{}{"service_name": deployment.Name, "result": "wait_failed"})
 	}
-	if deploymentK8sKind, found = deployment.Annotations[kubernetes.AnnotationK8sKindKey]; !found {
-		HandleError(
-			errors.WithCode(
-				"Unable to determine deployment kind from annotations",
-				errors.BadRequest,
-			),
-			command,
-		)
+	watcher, err := DeploymentRolloutWatcher(deployment, envK8s, client)
+	if err != nil {
+		ExitWithCode(command, ExitCodeCannotWait, err.Error(), map[string]interface{}{"service_name": deployment.Name, "result": "wait_failed"})
 	}
+	deploymentK8sName := deployment.Annotations[kubernetes.AnnotationK8sNameKey]
+	deploymentK8sKind, namespace := watcher.Kind, watcher.Namespace
 
-	namespace := fmt.Sprintf("user-%s", os.Getenv("USER"))
-	envK8s := GetEnvironmentKubernetes(command, environment)
-	if envK8s != nil && envK8s.Namespace != nil {
-		namespace = envK8s.Namespace.Namespace.Name
+	_, _ = ColoredOutput.HiBlue("Watching %s rollout of %s in namespace %s ...", deploymentK8sKind, watcher.Selector, namespace)
+	execStart := time.Now()
+	err = watcher.Wait(ctx)
+	if err != nil && ctx.Err() != nil {
+		return time.Since(execStart)
 	}
-
-	_, _ = ColoredOutput.HiBlue("Setting correct rancher kubectl context ...")
-	setRancherContext(environment, command, envK8s)
-
-	label := deployment.ShortName()
-	if deployment.HasLegacyShortname() {
-		label = deployment.ShortNameLegacy()
+	if err != nil && RolloutExitCode(err) == ExitCodeCannotWait {
+		_ = beeep.Notify("usi wait", fmt.Sprintf("Unable to wait for %s deployment.", deployment.Name), "")
+		ExitWithCode(command, ExitCodeCannotWait, fmt.Sprintf("Unable to follow the rollout of %s: %s", deploymentK8sName, err.Error()),
+			map[string]interface{}{"service_name": deployment.Name, "result": "wait_failed"})
 	}
-	cmdArgs := []string{
-		"rancher",
-		"kubectl",
-		"rollout",
-		"status",
-		deploymentK8sKind,
-		"-n",
-		namespace,
-		"-l",
-		fmt.Sprintf("app=%s", label),
-	}
-	cmdArgsString := strings.Join(cmdArgs, " ")
-	_, _ = ColoredOutput.HiBlue("Running wait command ...")
-	_, _ = fmt.Fprintf(os.Stdout, "> ")
-	_, _ = ColoredOutput.Green("%s\n", cmdArgsString)
-	execStart := time.Now()
-	cmd := exec.Command("bash", "-c", cmdArgsString)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
 	if err != nil {
 		_ = beeep.Notify("usi wait", fmt.Sprintf("Failed to wait for %s deployment.", deployment.Name), "")
-		HandleError(
-			errors.WithCode(
-				fmt.Sprintf(
-					"Failed to wait for %s deployment. Check the application's logs for errors.",
-					deploymentK8sName,
-				),
-				errors.BadRequest,
-			),
-			command,
-		)
+		ExitWithCode(command, ExitCodeRolloutFailed, fmt.Sprintf(
+			"Failed to wait for %s deployment: %s. Check the application's logs for errors.",
+			deploymentK8sName,
+			err.Error(),
+		), map[string]interface{}{
+			"service_name": deployment.Name,
+			"result":       "rollout_failed",
+		})
 	}
 	dur := time.Since(execStart)
 	dur = dur.Round(time.Second)
@@ -156,54 +212,36 @@ func WaitForDeployment(deployment *deployment.Resource, environment, command str
 	return dur
 }
 
-func validateRancherCli(command string) {
-	cmd := exec.Command("rancher")
-	err := cmd.Run()
-	if err != nil {
-		HandleError(
-			errors.WithCode(
-				"Rancher CLI must be setup on your machine. See http://cg/rancher-cli",
-				errors.BadRequest,
-			),
-			command,
-		)
+// DeploymentRolloutWatcher finds the kubernetes workload of a deployment from its annotations and
+// the namespace of its environment.
+func DeploymentRolloutWatcher(deployment *deployment.Resource, envK8s *registry.EnvironmentKubernetesResponse, client k8s.Interface) (RolloutWatcher, error) {
+	if _, found := deployment.Annotations[kubernetes.AnnotationK8sNameKey]; !found {
+		return RolloutWatcher{}, fmt.Errorf("unable to determine deployment name from annotations")
 	}
-}
-
-func setRancherContext(environment, command string, envK8s *registry.EnvironmentKubernetesResponse) {
-	rancherProject := ""
-	if envK8s != nil && envK8s.Cluster != nil && envK8s.Cluster.ProjectId != nil && envK8s.Cluster.ClusterId != nil {
-		rancherProject = fmt.Sprintf("%s:%s", *envK8s.Cluster.ClusterId, *envK8s.Cluster.ProjectId)
+	deploymentK8sKind, found := deployment.Annotations[kubernetes.AnnotationK8sKindKey]
+	if !found {
+		return RolloutWatcher{}, fmt.Errorf("unable to determine deployment kind from annotations")
 	}
 
-	if rancherProject == "" {
-		HandleError(
-			errors.WithCode(
-				fmt.Sprintf("Unable to set rancher context for environment %s", environment),
-				errors.NotImplemented,
-			),
-			command,
-		)
+	label := deployment.ShortName()
+	if deployment.HasLegacyShortname() {
+		label = deployment.ShortNameLegacy()
 	}
+	return RolloutWatcher{
+		Client:    client,
+		Namespace: environmentNamespace(envK8s),
+		Kind:      deploymentK8sKind,
+		Selector:  fmt.Sprintf("app=%s", label),
+	}, nil
+}
 
-	cmdArgs := []string{"context", "switch", rancherProject}
-	_, _ = fmt.Fprintf(os.Stdout, "> ")
-	_, _ = ColoredOutput.Green("rancher %s\n", strings.Join(cmdArgs, " "))
-	cmd := exec.Command("rancher", cmdArgs...)
-	err := cmd.Run()
-	if err != nil {
-		HandleError(
-			errors.WithCode(
-				fmt.Sprintf(
-					"Unable to set rancher context for environment %s to %s",
-					environment,
-					rancherProject,
-				),
-				errors.NotImplemented,
-			),
-			command,
-		)
+// environmentNamespace is the kubernetes namespace of an environment, the user's own namespace
+// when the registry doesn't record one.
+func environmentNamespace(envK8s *registry.EnvironmentKubernetesResponse) string {
+	if envK8s != nil && envK8s.Namespace != nil {
+		return envK8s.Namespace.Namespace.Name
 	}
+	return fmt.Sprintf("user-%s", os.Getenv("USER"))
 }
 
 //test
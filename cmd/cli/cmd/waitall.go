@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gen2brain/beeep"
+	"platform-go-common/pkg/errors"
+
+	"usi/pkg/core"
+	"usi/pkg/type/deployment"
+)
+
+const (
+	waitStateWaiting   = "waiting"
+	waitStateRollout   = "rolling out"
+	waitStateEndpoints = "checking endpoints"
+	waitStateReady     = "ready"
+	waitStateFailed    = "failed"
+	waitStateUnhealthy = "unhealthy"
+	waitStateSkipped   = "skipped"
+	waitStateCancelled = "cancelled"
+)
+
+// waitRow is one deployment of the `usi wait` status table.
+type waitRow struct {
+	name     string
+	state    string
+	message  string
+	duration time.Duration
+	exitCode int
+}
+
+func (r *waitRow) finished() bool {
+	return r.state != waitStateWaiting && r.state != waitStateRollout && r.state != waitStateEndpoints
+}
+
+// WaitTable is the status table of `usi wait` for several deployments. On a terminal it is redrawn
+// in place every second, otherwise each status change is printed as a line.
+type WaitTable struct {
+	mu      sync.Mutex
+	out     io.Writer
+	live    bool
+	drawn   int
+	stopped bool
+	start   time.Time
+	rows    []*waitRow
+}
+
+func NewWaitTable(out *os.File, names []string) *WaitTable {
+	t := &WaitTable{out: out, start: time.Now()}
+	if stat, err := out.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		t.live = true
+	}
+	for _, name := range names {
+		t.rows = append(t.rows, &waitRow{name: name, state: waitStateWaiting})
+	}
+	return t
+}
+
+func (t *WaitTable) update(i int, state, message string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	row := t.rows[i]
+	if row.state == state && row.message == message {
+		return
+	}
+	row.state, row.message = state, message
+	if row.finished() {
+		row.duration = time.Since(t.start)
+	}
+	if !t.live && !t.stopped {
+		_, _ = fmt.Fprintf(t.out, "[%s] %s %s\n", row.name, state, message)
+	}
+}
+
+func (t *WaitTable) finish(i int, state, message string, exitCode int) {
+	t.update(i, state, message)
+	t.mu.Lock()
+	t.rows[i].exitCode = exitCode
+	t.mu.Unlock()
+}
+
+// Render redraws the table over its previous drawing. It does nothing when not on a terminal.
+func (t *WaitTable) Render() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.live || t.stopped {
+		return
+	}
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "DEPLOYMENT\tSTATUS\tTIME\tDETAIL")
+	for _, row := range t.rows {
+		elapsed := row.duration
+		if !row.finished() {
+			elapsed = time.Since(t.start)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", row.name, row.state, elapsed.Round(time.Second), truncate(row.message, 80))
+	}
+	_ = w.Flush()
+
+	if t.drawn > 0 {
+		_, _ = fmt.Fprintf(t.out, "\033[%dA", t.drawn)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for _, line := range lines {
+		_, _ = fmt.Fprintf(t.out, "\033[2K%s\n", line)
+	}
+	t.drawn = len(lines)
+}
+
+// PrintSummary stops the live table and prints the result and duration of every deployment. Only
+// the first call prints, so the summary isn't repeated when a cancelled wait is also reported by
+// its Operation.
+func (t *WaitTable) PrintSummary() {
+	t.Render()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	t.stopped = true
+	PrintHeader("Waited for %d deployments in %s", len(t.rows), time.Since(t.start).Round(time.Second))
+	w := tabwriter.NewWriter(t.out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "DEPLOYMENT\tRESULT\tDURATION\tDETAIL")
+	for _, row := range t.rows {
+		state, detail, duration := row.state, "", "-"
+		if !row.finished() {
+			state = waitStateCancelled + " (" + row.state + ")"
+		} else {
+			duration = row.duration.Round(time.Second).String()
+		}
+		if row.state != waitStateReady {
+			detail = row.message
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", row.name, state, duration, detail)
+	}
+	_ = w.Flush()
+}
+
+// Failures returns the rows that didn't become ready, and the exit code that describes them best:
+// a failed rollout wins over an unhealthy endpoint, which wins over a rollout that couldn't be
+// followed, which wins over any other failure.
+func (t *WaitTable) Failures() ([]string, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var failed []string
+	exitCode := 0
+	for _, row := range t.rows {
+		if row.state == waitStateReady || row.state == waitStateSkipped {
+			continue
+		}
+		failed = append(failed, row.name)
+		switch {
+		case row.exitCode == ExitCodeRolloutFailed || exitCode == ExitCodeRolloutFailed:
+			exitCode = ExitCodeRolloutFailed
+		case row.exitCode == ExitCodeUnhealthy || exitCode == ExitCodeUnhealthy:
+			exitCode = ExitCodeUnhealthy
+		case row.exitCode == ExitCodeCannotWait || exitCode == ExitCodeCannotWait:
+			exitCode = ExitCodeCannotWait
+		default:
+			exitCode = 1
+		}
+	}
+	return failed, exitCode
+}
+
+// WaitDeployments picks the deployments `usi wait` waits for: the named ones, or else every
+// deployment of the environment matching the selector.
+func WaitDeployments(command, environmentName string, names []string, selectorString string) []deployment.Resource {
+	var deployments []deployment.Resource
+	if len(names) > 0 {
+		selector := StrToSelector(&selectorString, command)
+		for _, name := range names {
+			AssertDeployment(command, environmentName, core.JoinNameAndSelector(name, selector))
+			d := GetServiceDeployment(command, environmentName, name, selector)
+			if d == nil {
+				HandleError(errors.WithCode(fmt.Sprintf("Unable to find deployment (%s) in environment {%s}", name, environmentName), errors.NotFound),
+					command)
+			}
+			deployments = append(deployments, *d)
+		}
+		return deployments
+	}
+
+	var selectors []string
+	if selectorString != "" {
+		selectors = StrToSelector(&selectorString, command).Selectors
+	}
+	for _, d := range GetDeployments(command, environmentName) {
+		matches := true
+		for _, s := range selectors {
+			matches = matches && d.Selector.MatchesSelector(s)
+		}
+		if matches {
+			deployments = append(deployments, d)
+		}
+	}
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].Name < deployments[j].Name
+	})
+	return deployments
+}
+
+// WaitForDeployments waits concurrently for the rollout, and with httpReady the endpoints, of every
+// deployment. Deployments outside user namespaces are skipped since they can't be waited for. When
+// ctx is cancelled it returns without printing the summary, leaving the report to the caller.
+func WaitForDeployments(ctx context.Context, deployments []deployment.Resource, environment, command string, httpReady bool, table *WaitTable) {
+	devDeploys := 0
+	dev := make([]bool, len(deployments))
+	for i := range deployments {
+		if dev[i] = IsDevEnvironmentDeployment(&deployments[i], command); dev[i] {
+			devDeploys++
+		} else {
+			table.finish(i, waitStateSkipped, "not in a user namespace", 0)
+		}
+	}
+	if devDeploys == 0 {
+		HandleError(
+			errors.WithCode(
+				fmt.Sprintf("Unable to wait for deployments within environment %s", environment),
+				errors.BadRequest,
+			),
+			command,
+		)
+	}
+
+	envK8s := GetEnvironmentKubernetes(command, environment)
+	client, err := NewKubernetesClient(envK8s)
+	if err != nil {
+		HandleError(
+			errors.WithCode(
+				fmt.Sprintf("Unable to connect to the kubernetes cluster of environment %s: %s", environment, err.Error()),
+				errors.BadRequest,
+			),
+			command,
+		)
+	}
+
+	var wg sync.WaitGroup
+	for i := range deployments {
+		if !dev[i] {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, d *deployment.Resource) {
+			defer wg.Done()
+			watcher, err := DeploymentRolloutWatcher(d, envK8s, client)
+			if err != nil {
+				table.finish(i, waitStateFailed, err.Error(), ExitCodeCannotWait)
+				return
+			}
+			watcher.Progress = func(status RolloutStatus) {
+				table.update(i, waitStateRollout, status.Message)
+			}
+			if err := watcher.Wait(ctx); err != nil {
+				if ctx.Err() == nil {
+					table.finish(i, waitStateFailed, err.Error(), RolloutExitCode(err))
+				}
+				return
+			}
+			if !httpReady {
+				table.finish(i, waitStateReady, "", 0)
+				return
+			}
+
+			urls := ReadinessURLs(d, command)
+			if len(urls) == 0 {
+				table.finish(i, waitStateReady, "no links or ingress hosts to check", 0)
+				return
+			}
+			table.update(i, waitStateEndpoints, fmt.Sprintf("%d endpoints", len(urls)))
+			unhealthy := WaitForEndpoints(ctx, urls, func(u, status string) {
+				if status != "" {
+					table.update(i, waitStateEndpoints, u+": "+status)
+				}
+			})
+			switch {
+			case len(unhealthy) > 0 && ctx.Err() != nil:
+				table.update(i, waitStateEndpoints, UnhealthyEndpoints(unhealthy))
+			case len(unhealthy) > 0:
+				table.finish(i, waitStateUnhealthy, UnhealthyEndpoints(unhealthy), ExitCodeUnhealthy)
+			default:
+				table.finish(i, waitStateReady, "", 0)
+			}
+		}(i, &deployments[i])
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	table.Render()
+	for {
+		select {
+		case <-done:
+			if ctx.Err() != nil {
+				// the caller's Operation prints the summary and exits with the timeout or interrupt code
+				return
+			}
+			table.PrintSummary()
+			failed, _ := table.Failures()
+			message := fmt.Sprintf("%d deployments in %s are ready", devDeploys, environment)
+			if len(failed) > 0 {
+				message = fmt.Sprintf("%d of %d deployments in %s failed", len(failed), devDeploys, environment)
+			}
+			_ = beeep.Notify("usi wait", message, "")
+			return
+		case <-ticker.C:
+			table.Render()
+		}
+	}
+}
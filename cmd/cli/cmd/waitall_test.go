@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testWaitTable(out *bytes.Buffer, states ...string) *WaitTable {
+	t := &WaitTable{out: out, start: time.Now()}
+	for i, state := range states {
+		t.rows = append(t.rows, &waitRow{name: string(rune('a' + i)), state: state})
+	}
+	return t
+}
+
+func TestWaitTableFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		states   []string
+		codes    []int
+		want     []string
+		wantCode int
+	}{
+		{name: "all ready", states: []string{waitStateReady, waitStateSkipped}, codes: []int{0, 0}},
+		{name: "unhealthy", states: []string{waitStateReady, waitStateUnhealthy}, codes: []int{0, ExitCodeUnhealthy},
+			want: []string{"b"}, wantCode: ExitCodeUnhealthy},
+		{name: "rollout failure wins", states: []string{waitStateFailed, waitStateUnhealthy}, codes: []int{ExitCodeRolloutFailed, ExitCodeUnhealthy},
+			want: []string{"a", "b"}, wantCode: ExitCodeRolloutFailed},
+		{name: "unhealthy wins over not followed", states: []string{waitStateFailed, waitStateUnhealthy}, codes: []int{ExitCodeCannotWait, ExitCodeUnhealthy},
+			want: []string{"a", "b"}, wantCode: ExitCodeUnhealthy},
+		{name: "not followed", states: []string{waitStateFailed, waitStateFailed}, codes: []int{1, ExitCodeCannotWait},
+			want: []string{"a", "b"}, wantCode: ExitCodeCannotWait},
+		{name: "other failure", states: []string{waitStateFailed}, codes: []int{1}, want: []string{"a"}, wantCode: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := testWaitTable(&bytes.Buffer{}, tt.states...)
+			for i, code := range tt.codes {
+				table.rows[i].exitCode = code
+			}
+			got, code := table.Failures()
+			if !reflect.DeepEqual(got, tt.want) || code != tt.wantCode {
+				t.Errorf("Failures() = %v, %d, want %v, %d", got, code, tt.want, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestWaitTablePrintSummaryOnce(t *testing.T) {
+	var out bytes.Buffer
+	table := testWaitTable(&out, waitStateReady, waitStateRollout)
+	table.PrintSummary()
+	table.PrintSummary()
+	if n := strings.Count(out.String(), "DEPLOYMENT"); n != 1 {
+		t.Errorf("summary printed %d times, want once:\n%s", n, out.String())
+	}
+	if !strings.Contains(out.String(), waitStateCancelled+" ("+waitStateRollout+")") {
+		t.Errorf("summary doesn't show the unfinished deployment as cancelled:\n%s", out.String())
+	}
+
+	table.update(0, waitStateFailed, "late update")
+	if strings.Contains(out.String(), "late update") {
+		t.Errorf("table printed an update after its summary:\n%s", out.String())
+	}
+}
@@ -36,7 +36,9 @@ func main() {
 	app.Command("get", "get options", cmd.CmdGet)
 	app.Command("help", "show usage information and help", func(cmd *cli.Cmd) { cmd.Action = app.PrintLongHelp })
 	app.Command("init", "new workspace", cmd.CmdInit)
+	app.Command("redeploy", "redeploy an existing deployment without a workspace", cmd.CmdRedeploy)
 	app.Command("resolve", "resolve configuration for a service", cmd.CmdResolve)
+	app.Command("rollback", "roll a deployment back to a previous revision", cmd.CmdRollback)
 	app.Command("run", "run a predefined script", cmd.CmdRun)
 	app.Command("debug", "debug mode", func(app *cli.Cmd) {
 		app.Command("logs", "print out local logs", cmd.CmdDebugLogs)